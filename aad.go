@@ -0,0 +1,115 @@
+package hmacsigner
+
+import (
+	"encoding/binary"
+	"hash"
+	"sort"
+)
+
+// aadPart is associated data covered by the signature but not included in
+// the token. The label keeps data provided for different purposes apart.
+type aadPart struct {
+	label string
+	value []byte
+}
+
+// writeAAD writes the parts to the mac, with all lengths prefixed so that
+// no two lists of parts write the same bytes.
+func writeAAD(mac hash.Hash, aad []aadPart) {
+	var l [binary.MaxVarintLen64]byte
+	mac.Write(l[:binary.PutUvarint(l[:], uint64(len(aad)))])
+	for _, part := range aad {
+		mac.Write(l[:binary.PutUvarint(l[:], uint64(len(part.label)))])
+		mac.Write([]byte(part.label))
+		mac.Write(l[:binary.PutUvarint(l[:], uint64(len(part.value)))])
+		mac.Write(part.value)
+	}
+}
+
+// GenAAD returns the signed payload, with the signature also covering the
+// associated data. The associated data is not included in the token, and
+// must be provided to ParseAAD.
+func (s *Signer) GenAAD(payload, aad []byte) []byte {
+	return genOrNil(s.gen(&header{}, []aadPart{{"aad", aad}}, payload))
+}
+
+// ParseAAD verifies b like Parse, additionally ensuring it was generated by
+// GenAAD with the same associated data.
+func (s *Signer) ParseAAD(b, aad []byte) ([]byte, error) {
+	t := token{aad: []aadPart{{"aad", aad}}}
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return t.payload, nil
+}
+
+// GenMany returns a token like GenAAD for each of the associated data, all
+// signing the same payload. Each token has its own salt, and they share a
+// single allocation.
+func (s *Signer) GenMany(payload []byte, aads [][]byte) [][]byte {
+	tokens := make([][]byte, len(aads))
+	if len(aads) == 0 {
+		return tokens
+	}
+	if tokens[0] = s.GenAAD(payload, aads[0]); tokens[0] == nil {
+		return tokens
+	}
+	buf := make([]byte, 0, len(tokens[0])*(len(aads)-1))
+	for i, aad := range aads[1:] {
+		start := len(buf)
+		var err error
+		buf, err = s.appendGen(buf, &header{}, []aadPart{{"aad", aad}}, payload)
+		if err != nil {
+			break
+		}
+		tokens[i+1] = buf[start:len(buf):len(buf)]
+	}
+	return tokens
+}
+
+// contextAAD returns the parts for the context, sorted by key.
+func contextAAD(ctx map[string]string) []aadPart {
+	keys := make([]string, 0, len(ctx))
+	for k := range ctx {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	aad := make([]aadPart, len(keys))
+	for i, k := range keys {
+		aad[i] = aadPart{"ctx " + k, []byte(ctx[k])}
+	}
+	return aad
+}
+
+// GenWithContext is like GenAAD, but takes the associated data as key value
+// pairs. The same pairs must be provided to ParseWithContext.
+func (s *Signer) GenWithContext(payload []byte, ctx map[string]string) []byte {
+	return genOrNil(s.gen(&header{}, contextAAD(ctx), payload))
+}
+
+// ParseWithContext verifies b like Parse, additionally ensuring it was
+// generated by GenWithContext with the same key value pairs.
+func (s *Signer) ParseWithContext(b []byte, ctx map[string]string) ([]byte, error) {
+	t := token{aad: contextAAD(ctx)}
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return t.payload, nil
+}
+
+// GenBound is like GenAAD, but binds the token to a channel, such as TLS
+// exporter keying material or a connection ID. It is only accepted by
+// ParseBound with the same binding.
+func (s *Signer) GenBound(payload, binding []byte) []byte {
+	return genOrNil(s.gen(&header{}, []aadPart{{"binding", binding}}, payload))
+}
+
+// ParseBound verifies b like Parse, additionally ensuring it was generated by
+// GenBound with the same binding.
+func (s *Signer) ParseBound(b, binding []byte) ([]byte, error) {
+	t := token{aad: []aadPart{{"binding", binding}}}
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return t.payload, nil
+}
@@ -0,0 +1,144 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestAAD(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.GenAAD([]byte("a@b.c"), []byte("session"))
+	payload, err := signer.ParseAAD(gen, []byte("session"))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	_, err = signer.ParseAAD(gen, []byte("sessioN"))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseAAD(gen, nil)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseAAD(signer.Gen([]byte("a@b.c")), nil)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	payload, err = signer.ParseAAD(signer.GenAAD(nil, nil), nil)
+	ensure.Nil(t, err)
+	ensure.True(t, payload == nil)
+}
+
+func TestGenMany(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	aads := [][]byte{[]byte("phone"), []byte("laptop"), nil, []byte("tablet")}
+	tokens := signer.GenMany([]byte("a@b.c"), aads)
+	ensure.DeepEqual(t, len(tokens), len(aads))
+	for i, gen := range tokens {
+		for j, aad := range aads {
+			payload, err := signer.ParseAAD(gen, aad)
+			if i == j {
+				ensure.Nil(t, err, i)
+				ensure.DeepEqual(t, payload, []byte("a@b.c"))
+			} else {
+				ensure.DeepEqual(t, err, ErrSignatureMismatch, i, j)
+			}
+		}
+		for j := range tokens[:i] {
+			ensure.NotDeepEqual(t, gen[:encHeaderLen], tokens[j][:encHeaderLen])
+		}
+	}
+	ensure.DeepEqual(t, len(signer.GenMany(nil, nil)), 0)
+}
+
+func TestAADBoundary(t *testing.T) {
+	signer := Signer{Secret: bytes.Repeat([]byte("a"), 32)}
+	sig := func(aad []aadPart, payload string) []byte {
+		var out [sigLen]byte
+		sign(signer.Secret, []byte("header"), aad, []byte(payload), out[:0])
+		return out[:]
+	}
+	// Moving bytes between the associated data and the payload must not
+	// produce the same signature.
+	sigs := [][]byte{
+		sig(nil, "abc"),
+		sig([]aadPart{}, "abc"),
+		sig([]aadPart{{"aad", []byte("a")}}, "bc"),
+		sig([]aadPart{{"aad", []byte("ab")}}, "c"),
+		sig([]aadPart{{"aa", []byte("dab")}}, "c"),
+		sig([]aadPart{{"aad", nil}, {"aad", []byte("ab")}}, "c"),
+	}
+	for i := range sigs {
+		for j := range sigs[:i] {
+			ensure.NotDeepEqual(t, sigs[i], sigs[j], i, j)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	ctx := map[string]string{"tenant": "acme", "region": "eu", "zone": "b"}
+	gen := signer.GenWithContext([]byte("a@b.c"), ctx)
+
+	// Built in a different order, which must not matter.
+	same := map[string]string{}
+	same["zone"] = "b"
+	same["region"] = "eu"
+	same["tenant"] = "acme"
+	payload, err := signer.ParseWithContext(gen, same)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	same["region"] = "us"
+	_, err = signer.ParseWithContext(gen, same)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseWithContext(gen, map[string]string{
+		"tenant": "acme", "region": "eu",
+	})
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	// The key is bound to its value.
+	_, err = signer.ParseWithContext(
+		signer.GenWithContext(nil, map[string]string{"a": "bc"}),
+		map[string]string{"ab": "c"})
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseAAD(
+		signer.GenWithContext(nil, map[string]string{"aad": "a"}), []byte("a"))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	_, err = signer.ParseWithContext(signer.GenWithContext(nil, nil),
+		map[string]string{})
+	ensure.Nil(t, err)
+}
+
+func TestBound(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	binding := bytes.Repeat([]byte{1}, 32)
+	gen := signer.GenBound([]byte("a@b.c"), binding)
+	payload, err := signer.ParseBound(gen, binding)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	_, err = signer.ParseBound(gen, bytes.Repeat([]byte{2}, 32))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseAAD(gen, binding)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.ParseBound(signer.GenAAD([]byte("a@b.c"), binding), binding)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
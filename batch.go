@@ -0,0 +1,36 @@
+package hmacsigner
+
+// peekVersion returns the version of b without decoding the rest of it.
+func (s *Signer) peekVersion(b []byte) (byte, error) {
+	v, _, err := decodePrefix(s.encoding(), b)
+	for _, enc := range s.LegacyEncodings {
+		if err == nil {
+			break
+		}
+		v, _, err = decodePrefix(enc, b)
+	}
+	return v, err
+}
+
+// ParseBatch parses each of the tokens like Parse. The returned payloads and
+// errors are aligned with the tokens. Tokens without a readable version are
+// rejected without decoding the rest of them. They are still recorded in
+// the Metrics, and burned with UniformTiming, like Parse would.
+func (s *Signer) ParseBatch(tokens [][]byte) ([][]byte, []error) {
+	payloads := make([][]byte, len(tokens))
+	errs := make([]error, len(tokens))
+	for i, b := range tokens {
+		if s.MaxTokenLen == 0 || len(b) <= s.MaxTokenLen {
+			if _, err := s.peekVersion(b); err != nil {
+				errs[i] = err
+				s.record(err)
+				if s.UniformTiming {
+					s.burn(len(b))
+				}
+				continue
+			}
+		}
+		payloads[i], errs[i] = s.Parse(b)
+	}
+	return payloads, errs
+}
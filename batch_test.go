@@ -0,0 +1,82 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestParseBatch(t *testing.T) {
+	metrics := countingMetrics{}
+	signer := Signer{
+		Secret:  bytes.Repeat([]byte("a"), 32),
+		TTL:     time.Hour,
+		Metrics: metrics,
+	}
+	other := Signer{
+		Secret: bytes.Repeat([]byte("b"), 32),
+		TTL:    time.Hour,
+	}
+	tokens := [][]byte{
+		signer.Gen([]byte("a")),
+		nil,
+		[]byte(strings.Repeat("$", encHeaderLen)),
+		[]byte(strings.Repeat("A", encHeaderLen)),
+		other.Gen([]byte("b")),
+		signer.Gen([]byte("c")),
+	}
+	payloads, errs := signer.ParseBatch(tokens)
+	ensure.DeepEqual(t, errs, []error{
+		nil,
+		ErrTooShort,
+		ErrInvalidEncoding,
+		ErrInvalidVersion,
+		ErrSignatureMismatch,
+		nil,
+	})
+	ensure.DeepEqual(t, payloads, [][]byte{
+		[]byte("a"), nil, nil, nil, nil, []byte("c"),
+	})
+	ensure.DeepEqual(t, metrics, countingMetrics{
+		KindSuccess:   2,
+		KindMalformed: 3,
+		KindMismatch:  1,
+	})
+}
+
+func BenchmarkParseBatch(b *testing.B) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	var tokens [][]byte
+	for i := 0; i < 100; i++ {
+		switch i % 4 {
+		case 0:
+			tokens = append(tokens, signer.Gen([]byte(fmt.Sprint(i))))
+		case 1:
+			tokens = append(tokens, []byte(strings.Repeat("A", encHeaderLen)))
+		case 2:
+			tokens = append(tokens, []byte(strings.Repeat("$", encHeaderLen+10)))
+		case 3:
+			tokens = append(tokens, []byte("garbage"))
+		}
+	}
+
+	b.Run("Parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, token := range tokens {
+				_, _ = signer.Parse(token)
+			}
+		}
+	})
+	b.Run("ParseBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			signer.ParseBatch(tokens)
+		}
+	})
+}
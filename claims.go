@@ -0,0 +1,93 @@
+package hmacsigner
+
+import "time"
+
+// Claims is the authenticated content of a token.
+type Claims struct {
+	Payload []byte
+
+	// Version and Flags describe the token format.
+	Version byte
+	Flags   uint16
+
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	NotBefore time.Time // NotBefore is zero unless set by GenNotBefore.
+	Salt      [saltLen]byte
+
+	SchemaVersion byte
+	ContentType   byte
+	KeyID         byte
+	Issuer        byte
+	Audience      string
+	Generation    byte
+}
+
+// ParseFull verifies b like Parse, and returns the payload along with the
+// rest of the authenticated content of the token.
+func (s *Signer) ParseFull(b []byte) (*Claims, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return s.claims(&t), nil
+}
+
+// ExpiresAt verifies b like Parse, and returns the time it expires, without
+// any Leeway. It allows aligning cache lifetimes with the token.
+func (s *Signer) ExpiresAt(b []byte) (time.Time, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return time.Time{}, err
+	}
+	return s.expiresAt(&t.header, s.acceptedTTL()), nil
+}
+
+// AgeBucket verifies b like Parse, and returns the index of the first of the
+// ascending buckets its age is less than, or len(buckets) if there is none.
+// It allows reporting the age of tokens with a low metric cardinality.
+func (s *Signer) AgeBucket(b []byte, buckets []time.Duration) (int, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return 0, err
+	}
+	age := t.now.Sub(s.time(t.header.issue))
+	for i, bucket := range buckets {
+		if age < bucket {
+			return i, nil
+		}
+	}
+	return len(buckets), nil
+}
+
+// expiresAt returns the time the token with the header h expires, when
+// accepted for ttl.
+func (s *Signer) expiresAt(h *header, ttl time.Duration) time.Time {
+	return s.time(h.issue).Add(ttl)
+}
+
+// claims returns the Claims for a verified token.
+func (s *Signer) claims(t *token) *Claims {
+	h := &t.header
+	c := &Claims{
+		Payload:       t.payload,
+		Version:       h.version,
+		Flags:         h.flags,
+		IssuedAt:      s.time(h.issue),
+		Salt:          h.salt,
+		SchemaVersion: h.schema,
+		ContentType:   h.contentType,
+		KeyID:         h.keyID,
+		Issuer:        h.issuer,
+		Generation:    h.generation,
+	}
+	c.ExpiresAt = s.expiresAt(h, s.acceptedTTL())
+	if h.flags&flagNotBefore != 0 {
+		c.NotBefore = s.time(h.notBefore)
+	}
+	if h.flags&flagAudience != 0 {
+		// Parse only accepts tokens for the configured Audience.
+		c.Audience = s.Audience
+	}
+	return c
+}
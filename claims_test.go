@@ -0,0 +1,182 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestParseFull(t *testing.T) {
+	issue := time.Now().Add(-time.Minute).Truncate(time.Second)
+	signer := Signer{
+		Secret:        bytes.Repeat([]byte("a"), 32),
+		TTL:           time.Hour,
+		SchemaVersion: 3,
+		Audience:      "api",
+		Generation:    7,
+		nowF:          func() time.Time { return issue },
+		saltF:         func(b []byte) { copy(b, "saltsalt") },
+	}
+	notBefore := issue.Add(time.Second)
+	claims, err := signer.ParseFull(signer.GenNotBefore([]byte("a@b.c"), notBefore))
+	ensure.Nil(t, err)
+	ensure.True(t, claims.IssuedAt.Equal(issue))
+	ensure.True(t, claims.ExpiresAt.Equal(issue.Add(time.Hour)))
+	ensure.True(t, claims.NotBefore.Equal(notBefore))
+	claims.IssuedAt, claims.ExpiresAt, claims.NotBefore = time.Time{}, time.Time{}, time.Time{}
+	ensure.DeepEqual(t, claims, &Claims{
+		Payload:       []byte("a@b.c"),
+		Version:       versionFlags,
+		Flags:         flagNotBefore | flagSchema | flagAudience | flagGeneration,
+		Salt:          [saltLen]byte{'s', 'a', 'l', 't', 's', 'a', 'l', 't'},
+		SchemaVersion: 3,
+		Audience:      "api",
+		Generation:    7,
+	})
+
+	plain := Signer{Secret: signer.Secret, TTL: time.Hour}
+	claims, err = plain.ParseFull(plain.Gen(nil))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, claims.Version, version)
+	ensure.DeepEqual(t, claims.Flags, uint16(0))
+	ensure.True(t, claims.NotBefore.IsZero())
+	ensure.DeepEqual(t, claims.Audience, "")
+
+	_, err = plain.ParseFull(signer.Gen(nil))
+	ensure.DeepEqual(t, err, ErrWrongAudience)
+}
+
+func TestContentType(t *testing.T) {
+	const (
+		typeJSON  = 1
+		typeProto = 2
+	)
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		Fingerprint: true,
+		ContentType: typeJSON,
+	}
+	gen := signer.Gen([]byte(`{"a":1}`))
+	claims, err := signer.ParseFull(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, claims.ContentType, byte(typeJSON))
+	ensure.DeepEqual(t, claims.Flags, flagFingerprint|flagContentType)
+	ensure.DeepEqual(t, claims.Payload, []byte(`{"a":1}`))
+
+	// The verifier does not need the same ContentType, so the caller can
+	// dispatch on it.
+	proto := signer
+	proto.ContentType = typeProto
+	claims, err = proto.ParseFull(gen)
+	ensure.Nil(t, err)
+	ensure.NotDeepEqual(t, claims.ContentType, byte(typeProto))
+
+	// It is covered by the signature.
+	raw, err := base64.RawURLEncoding.DecodeString(string(gen[:signer.encodedHeaderLen()]))
+	ensure.Nil(t, err)
+	raw[signer.headerLen(0)-sigLen-contentTypeLen] = typeProto
+	forged := base64.RawURLEncoding.EncodeToString(raw) +
+		string(gen[signer.encodedHeaderLen():])
+	_, err = signer.ParseFull([]byte(forged))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestIssuer(t *testing.T) {
+	const (
+		issuerBilling = 1
+		issuerAuth    = 2
+	)
+	billing := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		Issuer: issuerBilling,
+		KeyID:  7,
+	}
+	gen := billing.Gen([]byte("a@b.c"))
+	claims, err := billing.ParseFull(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, claims.Issuer, byte(issuerBilling))
+	ensure.DeepEqual(t, claims.KeyID, byte(7))
+	ensure.DeepEqual(t, claims.Flags, flagKeyID|flagIssuer)
+
+	verifier := Signer{
+		Secret:         billing.Secret,
+		TTL:            time.Hour,
+		AllowedIssuers: []byte{issuerAuth},
+	}
+	_, err = verifier.Parse(gen)
+	ensure.DeepEqual(t, err, ErrUnknownIssuer)
+	ensure.DeepEqual(t, kindOf(err), KindRejected)
+	ensure.NotNil(t, Compatible(&billing, &verifier))
+	_, err = verifier.Parse(verifier.Gen(nil))
+	ensure.DeepEqual(t, err, ErrUnknownIssuer)
+
+	verifier.AllowedIssuers = []byte{issuerAuth, issuerBilling}
+	payload, err := verifier.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+	ensure.Nil(t, Compatible(&billing, &verifier))
+
+	// Without an allowlist any issuer is accepted.
+	verifier.AllowedIssuers = nil
+	_, err = verifier.Parse(gen)
+	ensure.Nil(t, err)
+}
+
+func TestAgeBucket(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    2 * time.Hour,
+	}
+	buckets := []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+	cases := []struct {
+		Age    time.Duration
+		Bucket int
+	}{
+		{0, 0},
+		{30 * time.Second, 0},
+		{2 * time.Minute, 1},
+		{10 * time.Minute, 2},
+		{90 * time.Minute, 3},
+	}
+	for _, c := range cases {
+		issuer := signer
+		issue := time.Now().Add(-c.Age)
+		issuer.nowF = func() time.Time { return issue }
+		bucket, err := signer.AgeBucket(issuer.Gen([]byte("a@b.c")), buckets)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, bucket, c.Bucket, c.Age)
+	}
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}
+	_, err := signer.AgeBucket(forged.Gen(nil), buckets)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestExpiresAt(t *testing.T) {
+	issue := time.Now().Add(-time.Minute)
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	expires, err := signer.ExpiresAt(gen)
+	ensure.Nil(t, err)
+	ensure.True(t, expires.Equal(issue.Add(time.Hour)), expires)
+
+	signer.PreviousTTL = 2 * time.Hour
+	expires, err = signer.ExpiresAt(gen)
+	ensure.Nil(t, err)
+	ensure.True(t, expires.Equal(issue.Add(2*time.Hour)), expires)
+
+	// The timestamp is only trusted once verified.
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}
+	expires, err = signer.ExpiresAt(forged.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.True(t, expires.IsZero())
+}
@@ -0,0 +1,62 @@
+package hmacsigner
+
+import "encoding/json"
+
+// PayloadCodec serializes values into payloads and back.
+type PayloadCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// JSONCodec is the default PayloadCodec, backed by encoding/json.
+var JSONCodec PayloadCodec = jsonCodec{}
+
+func (s *Signer) codec() PayloadCodec {
+	if s.Codec == nil {
+		return JSONCodec
+	}
+	return s.Codec
+}
+
+// GenValue serializes v using the Codec and returns the signed payload.
+func (s *Signer) GenValue(v interface{}) ([]byte, error) {
+	payload, err := s.codec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.gen(&header{}, nil, payload)
+}
+
+// ParseValue verifies b like Parse and deserializes the payload into v using
+// the Codec.
+func (s *Signer) ParseValue(b []byte, v interface{}) error {
+	payload, err := s.Parse(b)
+	if err != nil {
+		return err
+	}
+	return s.codec().Unmarshal(payload, v)
+}
+
+// ParseValidated verifies b like Parse, and then returns the error from
+// validate for the payload if any. The validator only sees payloads with a
+// valid signature.
+func (s *Signer) ParseValidated(b []byte, validate func([]byte) error) ([]byte, error) {
+	payload, err := s.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,104 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+type user struct {
+	Name  string
+	Email string
+}
+
+func TestJSONValue(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	given := user{Name: "a", Email: "a@b.c"}
+	gen, err := signer.GenValue(given)
+	ensure.Nil(t, err)
+
+	var actual user
+	ensure.Nil(t, signer.ParseValue(gen, &actual))
+	ensure.DeepEqual(t, actual, given)
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Marshal(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	return []byte(s), nil
+}
+
+func (stringCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(data)
+	return nil
+}
+
+func TestCustomCodec(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		Codec:  stringCodec{},
+	}
+	gen, err := signer.GenValue("a@b.c")
+	ensure.Nil(t, err)
+
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	var actual string
+	ensure.Nil(t, signer.ParseValue(gen, &actual))
+	ensure.DeepEqual(t, actual, "a@b.c")
+
+	_, err = signer.GenValue(42)
+	ensure.Err(t, err, regexp.MustCompile("not a string"))
+}
+
+func TestParseValueError(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	var actual user
+	ensure.DeepEqual(t, signer.ParseValue(nil, &actual), ErrTooShort)
+}
+
+func TestParseValidated(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	errNoAt := errors.New("missing @")
+	var validated [][]byte
+	validate := func(payload []byte) error {
+		validated = append(validated, payload)
+		if !bytes.Contains(payload, []byte("@")) {
+			return errNoAt
+		}
+		return nil
+	}
+
+	payload, err := signer.ParseValidated(signer.Gen([]byte("a@b.c")), validate)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	payload, err = signer.ParseValidated(signer.Gen([]byte("abc")), validate)
+	ensure.DeepEqual(t, err, errNoAt)
+	ensure.True(t, payload == nil)
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	_, err = signer.ParseValidated(forged.Gen([]byte("abc")), validate)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.DeepEqual(t, validated, [][]byte{[]byte("a@b.c"), []byte("abc")})
+}
@@ -0,0 +1,144 @@
+package hmacsigner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// ConfigVersion is the version of the Config format.
+const ConfigVersion = 1
+
+// Config is the serializable configuration of a Signer, excluding the secret
+// and any hooks. Signers and verifiers built from the same Config and secret
+// agree on the token format and keys, as long as they also share the Pepper
+// and BootID, which being secret are not part of it. The Epoch is in Unix
+// nanoseconds.
+type Config struct {
+	Version         int           `json:"version"`
+	TTL             time.Duration `json:"ttl"`
+	Encoding        string        `json:"encoding"`
+	LegacyEncodings []string      `json:"legacy_encodings,omitempty"`
+	SaltLen         int           `json:"salt_len"`
+	Hash            string        `json:"hash"`
+	UniformTiming   bool          `json:"uniform_timing,omitempty"`
+	URLBudget       int           `json:"url_budget,omitempty"`
+	Delimiter       string        `json:"delimiter,omitempty"`
+	Epoch           int64         `json:"epoch,omitempty"`
+	KeyPeriod       time.Duration `json:"key_period,omitempty"`
+	StretchSecret   bool          `json:"stretch_secret,omitempty"`
+	Audience        string        `json:"audience,omitempty"`
+	TrailingSig     bool          `json:"trailing_sig,omitempty"`
+	Issuer          byte          `json:"issuer,omitempty"`
+}
+
+const configHash = "sha256"
+
+var encodingNames = []struct {
+	Name     string
+	Encoding Encoding
+}{
+	{"base64url-raw", base64.RawURLEncoding},
+	{"base64url", base64.URLEncoding},
+	{"base64-raw", base64.RawStdEncoding},
+	{"base64", base64.StdEncoding},
+	{"base32-fold", Base32Encoding},
+}
+
+func encodingName(enc Encoding) string {
+	for _, e := range encodingNames {
+		if e.Encoding == enc {
+			return e.Name
+		}
+	}
+	return "custom"
+}
+
+func encodingByName(name string) (Encoding, error) {
+	for _, e := range encodingNames {
+		if e.Name == name {
+			return e.Encoding, nil
+		}
+	}
+	return nil, fmt.Errorf("hmacsigner: unsupported encoding %q", name)
+}
+
+// Config returns the configuration of the Signer. A custom Encoding is
+// reported as "custom", which Config.Signer rejects.
+func (s *Signer) Config() Config {
+	c := Config{
+		Version:       ConfigVersion,
+		TTL:           s.TTL,
+		Encoding:      encodingName(s.encoding()),
+		SaltLen:       saltLen,
+		Hash:          configHash,
+		UniformTiming: s.UniformTiming,
+		URLBudget:     s.URLBudget,
+		KeyPeriod:     s.KeyPeriod,
+		StretchSecret: s.StretchSecret,
+		Audience:      s.Audience,
+		TrailingSig:   s.TrailingSig,
+		Issuer:        s.Issuer,
+	}
+	if s.Delimiter != 0 {
+		c.Delimiter = string([]byte{s.Delimiter})
+	}
+	if !s.Epoch.IsZero() {
+		c.Epoch = s.Epoch.UnixNano()
+	}
+	for _, enc := range s.LegacyEncodings {
+		c.LegacyEncodings = append(c.LegacyEncodings, encodingName(enc))
+	}
+	return c
+}
+
+// Signer returns a Signer with this configuration and the given secret. Any
+// Pepper or BootID must be set on it before use.
+func (c Config) Signer(secret []byte) (*Signer, error) {
+	if c.Version != ConfigVersion {
+		return nil, fmt.Errorf("hmacsigner: unsupported config version %v", c.Version)
+	}
+	if c.SaltLen != saltLen {
+		return nil, fmt.Errorf("hmacsigner: unsupported salt length %v", c.SaltLen)
+	}
+	if c.Hash != configHash {
+		return nil, fmt.Errorf("hmacsigner: unsupported hash %q", c.Hash)
+	}
+	if len(secret) < minSecretLen {
+		return nil, ErrSecretTooShort
+	}
+
+	enc, err := encodingByName(c.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Delimiter) > 1 {
+		return nil, fmt.Errorf("hmacsigner: delimiter %q is not a single byte", c.Delimiter)
+	}
+	s := &Signer{
+		Secret:        secret,
+		TTL:           c.TTL,
+		Encoding:      enc,
+		UniformTiming: c.UniformTiming,
+		URLBudget:     c.URLBudget,
+		KeyPeriod:     c.KeyPeriod,
+		StretchSecret: c.StretchSecret,
+		Audience:      c.Audience,
+		TrailingSig:   c.TrailingSig,
+		Issuer:        c.Issuer,
+	}
+	if c.Delimiter != "" {
+		s.Delimiter = c.Delimiter[0]
+	}
+	if c.Epoch != 0 {
+		s.Epoch = time.Unix(0, c.Epoch)
+	}
+	for _, name := range c.LegacyEncodings {
+		enc, err := encodingByName(name)
+		if err != nil {
+			return nil, err
+		}
+		s.LegacyEncodings = append(s.LegacyEncodings, enc)
+	}
+	return s, nil
+}
@@ -0,0 +1,148 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	secret := bytes.Repeat([]byte("a"), 32)
+	signer := Signer{
+		Secret:          secret,
+		TTL:             time.Minute,
+		Encoding:        base64.URLEncoding,
+		LegacyEncodings: []Encoding{base64.RawURLEncoding, base64.StdEncoding},
+		UniformTiming:   true,
+		URLBudget:       100,
+	}
+
+	blob, err := json.Marshal(signer.Config())
+	ensure.Nil(t, err)
+	var config Config
+	ensure.Nil(t, json.Unmarshal(blob, &config))
+	ensure.DeepEqual(t, config, Config{
+		Version:         ConfigVersion,
+		TTL:             time.Minute,
+		Encoding:        "base64url",
+		LegacyEncodings: []string{"base64url-raw", "base64"},
+		SaltLen:         8,
+		Hash:            "sha256",
+		UniformTiming:   true,
+		URLBudget:       100,
+	})
+
+	actual, err := config.Signer(secret)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, *actual, signer)
+
+	payload, err := actual.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+}
+
+func TestConfigFormat(t *testing.T) {
+	secret := bytes.Repeat([]byte("a"), 32)
+	signer := Signer{
+		Secret:        secret,
+		TTL:           time.Minute,
+		Encoding:      base64.RawURLEncoding,
+		Delimiter:     '.',
+		Epoch:         time.Unix(0, 1577836800e9),
+		KeyPeriod:     time.Hour,
+		StretchSecret: true,
+		Audience:      "api",
+		TrailingSig:   true,
+		Issuer:        3,
+	}
+
+	blob, err := json.Marshal(signer.Config())
+	ensure.Nil(t, err)
+	var config Config
+	ensure.Nil(t, json.Unmarshal(blob, &config))
+	actual, err := config.Signer(secret)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, *actual, signer)
+
+	payload, err := actual.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+}
+
+func TestConfigDefault(t *testing.T) {
+	config := (&Signer{TTL: time.Hour}).Config()
+	ensure.DeepEqual(t, config.Encoding, "base64url-raw")
+	signer, err := config.Signer(bytes.Repeat([]byte("a"), 32))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, signer.TTL, time.Hour)
+}
+
+func TestConfigErrors(t *testing.T) {
+	secret := bytes.Repeat([]byte("a"), 32)
+	valid := (&Signer{TTL: time.Hour}).Config()
+
+	cases := []struct {
+		Name   string
+		Config func(c *Config)
+		Secret []byte
+		Err    string
+	}{
+		{
+			Name:   "version",
+			Config: func(c *Config) { c.Version = 2 },
+			Err:    "unsupported config version 2",
+		},
+		{
+			Name:   "salt length",
+			Config: func(c *Config) { c.SaltLen = 16 },
+			Err:    "unsupported salt length 16",
+		},
+		{
+			Name:   "hash",
+			Config: func(c *Config) { c.Hash = "md5" },
+			Err:    `unsupported hash "md5"`,
+		},
+		{
+			Name:   "encoding",
+			Config: func(c *Config) { c.Encoding = "custom" },
+			Err:    `unsupported encoding "custom"`,
+		},
+		{
+			Name:   "legacy encoding",
+			Config: func(c *Config) { c.LegacyEncodings = []string{"hex"} },
+			Err:    `unsupported encoding "hex"`,
+		},
+		{
+			Name:   "delimiter",
+			Config: func(c *Config) { c.Delimiter = ".." },
+			Err:    `delimiter ".." is not a single byte`,
+		},
+		{
+			Name:   "short secret",
+			Config: func(c *Config) {},
+			Secret: secret[:31],
+			Err:    "secret too short",
+		},
+	}
+	for _, c := range cases {
+		config := valid
+		c.Config(&config)
+		s := c.Secret
+		if s == nil {
+			s = secret
+		}
+		_, err := config.Signer(s)
+		ensure.Err(t, err, regexp.MustCompile(c.Err), c.Name)
+	}
+}
+
+func TestConfigCustomEncoding(t *testing.T) {
+	signer := Signer{Encoding: base32.StdEncoding}
+	ensure.DeepEqual(t, signer.Config().Encoding, "custom")
+}
@@ -0,0 +1,31 @@
+package hmacsigner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+// DebugJSON verifies b like Parse, and describes it as a JSON object with
+// sorted keys for debugging. For a valid token it has the version, the UTC
+// issued_at, age_seconds, salt_hex, payload_len and a true valid. Otherwise
+// valid is false and reason is the error, along with the other fields if the
+// signature was verified before the token was rejected, as it is for expired
+// tokens. It never includes the payload, the signature nor the secret.
+func (s *Signer) DebugJSON(b []byte) ([]byte, error) {
+	var t token
+	err := s.verify(b, &t)
+	out := map[string]interface{}{"valid": err == nil}
+	if err != nil {
+		out["reason"] = err.Error()
+	}
+	switch kindOf(err) {
+	case KindSuccess, KindExpired, KindNotYetValid, KindRejected:
+		issue := s.time(t.header.issue)
+		out["version"] = t.header.version
+		out["issued_at"] = issue.UTC()
+		out["age_seconds"] = t.now.Sub(issue).Seconds()
+		out["salt_hex"] = hex.EncodeToString(t.header.salt[:])
+		out["payload_len"] = t.payloadLen
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,97 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestDebugJSON(t *testing.T) {
+	issue := time.Now().Add(-time.Minute).UTC()
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	claims, err := signer.ParseFull(gen)
+	ensure.Nil(t, err)
+
+	blob, err := signer.DebugJSON(gen)
+	ensure.Nil(t, err)
+	var actual map[string]interface{}
+	ensure.Nil(t, json.Unmarshal(blob, &actual))
+	age := actual["age_seconds"].(float64)
+	ensure.True(t, age >= 60 && age < 70, age)
+	delete(actual, "age_seconds")
+	ensure.DeepEqual(t, actual, map[string]interface{}{
+		"valid":       true,
+		"version":     float64(version),
+		"issued_at":   issue.Format(time.RFC3339Nano),
+		"salt_hex":    hex.EncodeToString(claims.Salt[:]),
+		"payload_len": float64(5),
+	})
+	ensure.False(t, bytes.Contains(blob, []byte("a@b.c")))
+	sig, err := signer.SignatureOf(gen)
+	ensure.Nil(t, err)
+	ensure.False(t, bytes.Contains(blob, []byte(hex.EncodeToString(sig))))
+
+	// An expired token still describes its verified header.
+	signer.TTL = time.Second
+	blob, err = signer.DebugJSON(gen)
+	ensure.Nil(t, err)
+	actual = nil
+	ensure.Nil(t, json.Unmarshal(blob, &actual))
+	ensure.DeepEqual(t, actual["valid"], false)
+	ensure.True(t, strings.HasPrefix(actual["reason"].(string),
+		"hmacsigner: timestamp expired"), actual["reason"])
+	ensure.DeepEqual(t, actual["payload_len"], float64(5))
+
+	// Failing to decode it with a legacy encoding does not lose the header.
+	signer.LegacyEncodings = []Encoding{base32.StdEncoding}
+	blob, err = signer.DebugJSON(gen)
+	ensure.Nil(t, err)
+	actual = nil
+	ensure.Nil(t, json.Unmarshal(blob, &actual))
+	ensure.DeepEqual(t, actual["issued_at"], issue.Format(time.RFC3339Nano))
+	ensure.DeepEqual(t, actual["payload_len"], float64(5))
+	signer.LegacyEncodings = nil
+
+	// Nor does verifying an expired token with a legacy encoding.
+	legacy := signer
+	legacy.Encoding = base64.StdEncoding
+	legacy.TTL = time.Hour
+	legacy.saltF = func(b []byte) {
+		// Encodes to slashes, which the Encoding rejects.
+		for i := range b {
+			b[i] = 0xff
+		}
+	}
+	gen = legacy.Gen([]byte("a@b.c"))
+	signer.LegacyEncodings = []Encoding{base64.StdEncoding}
+	blob, err = signer.DebugJSON(gen)
+	ensure.Nil(t, err)
+	actual = nil
+	ensure.Nil(t, json.Unmarshal(blob, &actual))
+	ensure.True(t, strings.HasPrefix(actual["reason"].(string),
+		"hmacsigner: timestamp expired"), actual["reason"])
+	ensure.DeepEqual(t, actual["issued_at"], issue.Format(time.RFC3339Nano))
+	claims, err = legacy.ParseFull(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual["salt_hex"], hex.EncodeToString(claims.Salt[:]))
+	signer.LegacyEncodings = nil
+
+	// A forged one is not trusted at all.
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	blob, err = signer.DebugJSON(forged.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(blob),
+		`{"reason":"hmacsigner: signature mismatch","valid":false}`)
+}
@@ -0,0 +1,28 @@
+package hmacsigner
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// ErrUnexpectedPayload indicates a valid token did not carry the
+// DefaultPayload.
+var ErrUnexpectedPayload = errors.New("hmacsigner: unexpected payload")
+
+// GenDefault returns the signed DefaultPayload.
+func (s *Signer) GenDefault() []byte {
+	return s.Gen(s.DefaultPayload)
+}
+
+// ParseExpectDefault verifies b like Parse, and ensures it carries the
+// DefaultPayload.
+func (s *Signer) ParseExpectDefault(b []byte) error {
+	payload, err := s.Parse(b)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(payload, s.DefaultPayload) != 1 {
+		return ErrUnexpectedPayload
+	}
+	return nil
+}
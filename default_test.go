@@ -0,0 +1,33 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestDefaultPayload(t *testing.T) {
+	issue := time.Now()
+	signer := Signer{
+		Secret:         bytes.Repeat([]byte("a"), 32),
+		TTL:            time.Hour,
+		DefaultPayload: []byte("ping"),
+		nowF:           func() time.Time { return issue },
+		saltF:          func(b []byte) { copy(b, "saltsalt") },
+	}
+	gen := signer.GenDefault()
+	ensure.DeepEqual(t, gen, signer.Gen([]byte("ping")))
+	ensure.Nil(t, signer.ParseExpectDefault(gen))
+
+	ensure.DeepEqual(t, signer.ParseExpectDefault(signer.Gen([]byte("pong"))),
+		ErrUnexpectedPayload)
+	ensure.DeepEqual(t, signer.ParseExpectDefault(signer.Gen(nil)),
+		ErrUnexpectedPayload)
+	ensure.DeepEqual(t, signer.ParseExpectDefault([]byte("garbage")),
+		ErrTooShort)
+
+	signer.DefaultPayload = nil
+	ensure.Nil(t, signer.ParseExpectDefault(signer.GenDefault()))
+}
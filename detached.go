@@ -0,0 +1,123 @@
+package hmacsigner
+
+import (
+	"io"
+	"time"
+)
+
+// GenDetached returns a token for the payload without including the payload
+// in it. The payload must be provided separately to VerifyDetachedReader.
+func (s *Signer) GenDetached(payload []byte) []byte {
+	if len(payload) == 0 {
+		// The payload is not included, so it needs no empty flag.
+		payload = nil
+	}
+	var h header
+	gen, err := s.gen(&h, nil, payload)
+	if err != nil {
+		return nil
+	}
+	if h.version == versionTrailing {
+		// Keep the signature following the payload.
+		head := s.encoding().EncodedLen(h.signedLen())
+		if s.Delimiter != 0 {
+			head++
+		}
+		return append(gen[:head], gen[len(gen)-s.encoding().EncodedLen(sigLen):]...)
+	}
+	return gen[:s.encodedHeaderLen()]
+}
+
+// GenDetachedReader is like GenDetached, but streams the payload from r.
+func (s *Signer) GenDetachedReader(r io.Reader) ([]byte, error) {
+	if s.EmbedLength {
+		return nil, errDetachedLength
+	}
+	secret, err := s.signingSecret()
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	if s.Fingerprint {
+		h.fingerprint = keyFingerprint(secret)
+	}
+	raw, n, err := s.newHeader(&h, nil, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	secret = s.periodKey(secret, s.time(h.issue))
+	mac := newMAC(secret, raw[:n], nil)
+	if _, err := io.Copy(mac, r); err != nil {
+		return nil, err
+	}
+	mac.Sum(raw[n:n])
+	s.issued(&h)
+
+	out := s.appendToken(nil, &h, raw[:], n, nil)
+	if h.version != versionTrailing {
+		// Drop the Delimiter left for the payload.
+		out = out[:s.encodedHeaderLen()]
+	}
+	return out, nil
+}
+
+// VerifyDetachedReader verifies a token generated by GenDetached, streaming
+// the payload from r. Memory use does not depend on the size of the payload.
+func (s *Signer) VerifyDetachedReader(header []byte, r io.Reader) error {
+	err := s.verifyDetachedReader(header, r)
+	s.record(err)
+	return err
+}
+
+func (s *Signer) verifyDetachedReader(b []byte, r io.Reader) error {
+	var h header
+	var raw [maxHeaderLen]byte
+	enc := s.encoding()
+	encLen, headerLen, err := decodeHeader(enc, b, &h, raw[:])
+	if err != nil {
+		return err
+	}
+	b = b[encLen:]
+	if h.version == versionTrailing {
+		if s.Delimiter != 0 {
+			if len(b) == 0 || b[0] != s.Delimiter {
+				return ErrInvalidEncoding
+			}
+			b = b[1:]
+		}
+		if b, err = decodeTrailingSig(enc, b, raw[headerLen:]); err != nil {
+			return err
+		}
+		headerLen += sigLen
+	}
+	if len(b) != 0 {
+		return ErrInvalidEncoding
+	}
+	if err := s.checkVersion(&h); err != nil {
+		return err
+	}
+	now := time.Now()
+	if h.flags&flagAAD != 0 {
+		return ErrSignatureMismatch
+	}
+	if err := s.checkFingerprint(&h); err != nil {
+		return err
+	}
+
+	signedLen := headerLen - sigLen
+	macs, err := s.newMACs(&h, raw[:signedLen], nil, now)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(macs, r)
+	if err != nil {
+		return err
+	}
+	if !macs.matches(raw[signedLen:headerLen]) {
+		return ErrSignatureMismatch
+	}
+	if h.flags&flagLength != 0 && int64(h.length) != n {
+		return ErrInvalidEncoding
+	}
+	return s.checkClaims(&h, now, s.acceptedTTL())
+}
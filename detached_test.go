@@ -0,0 +1,90 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+// patternReader produces n bytes of a repeating pattern, optionally with the
+// byte at flip changed, without holding them in memory.
+type patternReader struct {
+	n, off, flip int64
+}
+
+func (r *patternReader) Read(b []byte) (int, error) {
+	if r.off == r.n {
+		return 0, io.EOF
+	}
+	if remaining := r.n - r.off; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	for i := range b {
+		b[i] = byte(r.off)
+		if r.off == r.flip {
+			b[i] ^= 1
+		}
+		r.off++
+	}
+	return len(b), nil
+}
+
+func TestDetached(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	payload := []byte("a@b.c")
+	header := signer.GenDetached(payload)
+	ensure.DeepEqual(t, len(header), signer.Overhead())
+	ensure.Nil(t, signer.VerifyDetachedReader(header, bytes.NewReader(payload)))
+	ensure.DeepEqual(t,
+		signer.VerifyDetachedReader(header, bytes.NewReader([]byte("a@b.d"))),
+		ErrSignatureMismatch)
+	ensure.DeepEqual(t,
+		signer.VerifyDetachedReader(append(header, 'A'), bytes.NewReader(payload)),
+		ErrInvalidEncoding)
+
+	// Attached to its payload, it is a regular token.
+	actual, err := signer.Parse(append(header, "YUBiLmM"...))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual, payload)
+}
+
+func TestDetachedReaderLarge(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	const size = 64 << 20
+	header, err := signer.GenDetachedReader(&patternReader{n: size, flip: -1})
+	ensure.Nil(t, err)
+
+	ensure.Nil(t, signer.VerifyDetachedReader(header,
+		&patternReader{n: size, flip: -1}))
+	ensure.DeepEqual(t, signer.VerifyDetachedReader(header,
+		&patternReader{n: size, flip: size / 2}), ErrSignatureMismatch)
+	ensure.DeepEqual(t, signer.VerifyDetachedReader(header,
+		&patternReader{n: size - 1, flip: -1}), ErrSignatureMismatch)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestDetachedReaderError(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	_, err := signer.GenDetachedReader(errReader{})
+	ensure.DeepEqual(t, err.Error(), "read failed")
+	err = signer.VerifyDetachedReader(signer.GenDetached(nil), errReader{})
+	ensure.DeepEqual(t, err.Error(), "read failed")
+}
@@ -0,0 +1,135 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+)
+
+// Encoding converts between binary and text. *base64.Encoding and
+// *base32.Encoding both implement it.
+type Encoding interface {
+	Encode(dst, src []byte)
+	Decode(dst, src []byte) (int, error)
+	EncodedLen(n int) int
+	DecodedLen(n int) int
+}
+
+type foldEncoding struct {
+	*base32.Encoding
+}
+
+func (e foldEncoding) Decode(dst, src []byte) (int, error) {
+	return e.Encoding.Decode(dst, bytes.ToUpper(src))
+}
+
+// Base32Encoding is an unpadded base32 Encoding that decodes regardless of
+// case. Tokens using it are about 20% longer, but survive storage and
+// matching that folds case.
+var Base32Encoding Encoding = foldEncoding{
+	base32.StdEncoding.WithPadding(base32.NoPadding),
+}
+
+func (s *Signer) encoding() Encoding {
+	if s.Encoding == nil {
+		return base64.RawURLEncoding
+	}
+	return s.Encoding
+}
+
+// isDecodeErr reports if err indicates the data could not be decoded, as
+// opposed to being decoded and then rejected.
+func isDecodeErr(err error) bool {
+	return err == ErrTooShort || err == ErrInvalidEncoding || err == ErrTruncated
+}
+
+// decodePrefix decodes the version and flags at the start of b, which must
+// be long enough for the shortest header. Version 3 headers are the shortest,
+// as their signature is not part of them.
+func decodePrefix(enc Encoding, b []byte) (byte, uint16, error) {
+	if len(b) < enc.EncodedLen(prefixLen+issueLen+saltLen) {
+		return 0, 0, ErrTooShort
+	}
+	var prefix [8]byte
+	if _, err := enc.Decode(prefix[:], b[:enc.EncodedLen(prefixLen)]); err != nil {
+		return 0, 0, ErrInvalidEncoding
+	}
+	return readPrefix(prefix[:])
+}
+
+// LooksLikeToken cheaply reports whether b could be a token using enc. It
+// only checks that b is long enough for a header, and that it is made of the
+// alphabet of enc and its padding, which allows rejecting obviously malformed
+// input without decoding it. Tokens with a Delimiter need to be split first.
+func LooksLikeToken(b []byte, enc *base64.Encoding) bool {
+	if len(b) < enc.EncodedLen(noSaltHeaderLen) {
+		return false
+	}
+	// Each group of 6 bits in these 48 bytes is its own index, so they encode
+	// to the alphabet in order.
+	var sextets [48]byte
+	for i := 0; i < 64; i += 4 {
+		v := i<<18 | (i+1)<<12 | (i+2)<<6 | (i + 3)
+		sextets[i/4*3] = byte(v >> 16)
+		sextets[i/4*3+1] = byte(v >> 8)
+		sextets[i/4*3+2] = byte(v)
+	}
+	var alphabet [64]byte
+	enc.Encode(alphabet[:], sextets[:])
+	var valid [256]bool
+	for _, c := range alphabet {
+		valid[c] = true
+	}
+	// The header of a padded token is padded too, so padding is accepted
+	// anywhere.
+	if enc.EncodedLen(1) == 4 {
+		var padding [4]byte
+		enc.Encode(padding[:], []byte{0})
+		valid[padding[3]] = true
+	}
+	for _, c := range b {
+		if !valid[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// stripPadding returns b without the base64 padding at its end and before
+// the Delimiter, if the Encoding is unpadded base64. With a Delimiter each
+// part is padded on its own.
+func (s *Signer) stripPadding(b []byte) []byte {
+	if enc := s.encoding(); enc != base64.RawURLEncoding && enc != base64.RawStdEncoding {
+		return b
+	}
+	i := -1
+	if s.Delimiter != 0 {
+		i = bytes.IndexByte(b, s.Delimiter)
+	}
+	if i < 0 {
+		return b[:len(b)-paddingLen(b)]
+	}
+	header, payload := b[:i], b[i+1:]
+	header = header[:len(header)-paddingLen(header)]
+	payload = payload[:len(payload)-paddingLen(payload)]
+	if len(header)+1+len(payload) == len(b) {
+		return b
+	}
+	stripped := make([]byte, 0, len(header)+1+len(payload))
+	stripped = append(stripped, header...)
+	stripped = append(stripped, s.Delimiter)
+	return append(stripped, payload...)
+}
+
+// paddingLen returns the length of the base64 padding at the end of b, or 0
+// if it is not the padding the padded encoding would have.
+func paddingLen(b []byte) int {
+	n := 0
+	for n < 2 && n < len(b) && b[len(b)-1-n] == '=' {
+		n++
+	}
+	if n == 0 || (len(b)-n)%4+n != 4 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,185 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestLegacyEncoding(t *testing.T) {
+	givenPayload := []byte("a@b.c")
+	legacy := Signer{
+		Secret:   bytes.Repeat([]byte("a"), 32),
+		TTL:      time.Hour,
+		Encoding: base64.StdEncoding,
+	}
+	signer := Signer{
+		Secret:          legacy.Secret,
+		TTL:             time.Hour,
+		LegacyEncodings: []Encoding{base64.StdEncoding},
+	}
+
+	legacyToken := legacy.Gen(givenPayload)
+	ensure.True(t, bytes.Contains(legacyToken, []byte("=")))
+	_, err := (&Signer{Secret: legacy.Secret, TTL: time.Hour}).Parse(legacyToken)
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+
+	actual, err := signer.Parse(legacyToken)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual, givenPayload)
+
+	token := signer.Gen(givenPayload)
+	ensure.False(t, bytes.Contains(token, []byte("=")))
+	actual, err = signer.Parse(token)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual, givenPayload)
+
+	payloads, errs := signer.ParseBatch([][]byte{legacyToken, token})
+	ensure.DeepEqual(t, errs, []error{nil, nil})
+	ensure.DeepEqual(t, payloads, [][]byte{givenPayload, givenPayload})
+}
+
+func TestLegacyEncodingErrors(t *testing.T) {
+	signer := Signer{
+		Secret:          bytes.Repeat([]byte("a"), 32),
+		TTL:             time.Hour,
+		LegacyEncodings: []Encoding{base64.StdEncoding},
+	}
+	other := Signer{
+		Secret:   bytes.Repeat([]byte("b"), 32),
+		TTL:      time.Hour,
+		Encoding: base64.StdEncoding,
+	}
+
+	_, err := signer.Parse([]byte(strings.Repeat("$", encHeaderLen+2)))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+
+	_, err = signer.Parse(other.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestEncodedLenLegacyEncoding(t *testing.T) {
+	signer := Signer{
+		Secret:   bytes.Repeat([]byte("a"), 32),
+		TTL:      time.Hour,
+		Encoding: base64.StdEncoding,
+	}
+	for _, n := range []int{0, 1, 2, 3, 100} {
+		gen := signer.Gen(bytes.Repeat([]byte("a"), n))
+		ensure.DeepEqual(t, signer.EncodedLen(n), len(gen), n)
+	}
+}
+
+func TestBase32Encoding(t *testing.T) {
+	signer := Signer{
+		Secret:   bytes.Repeat([]byte("a"), 32),
+		TTL:      time.Hour,
+		Encoding: Base32Encoding,
+	}
+	for _, n := range []int{0, 1, 5, 100} {
+		var givenPayload []byte
+		if n > 0 {
+			givenPayload = bytes.Repeat([]byte("a"), n)
+		}
+		gen := signer.Gen(givenPayload)
+		ensure.DeepEqual(t, len(gen), signer.EncodedLen(n))
+
+		for _, variant := range [][]byte{gen, bytes.ToLower(gen), bytes.ToUpper(gen)} {
+			actual, err := signer.Parse(variant)
+			ensure.Nil(t, err, n)
+			ensure.DeepEqual(t, string(actual), string(givenPayload), n)
+		}
+	}
+
+	_, err := signer.Parse(bytes.Repeat([]byte("1"), signer.EncodedLen(0)))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+}
+
+func TestBase32EncodingConfig(t *testing.T) {
+	signer := Signer{TTL: time.Hour, Encoding: Base32Encoding}
+	config := signer.Config()
+	ensure.DeepEqual(t, config.Encoding, "base32-fold")
+	actual, err := config.Signer(bytes.Repeat([]byte("a"), 32))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual.Encoding, Base32Encoding)
+}
+
+func TestLooksLikeToken(t *testing.T) {
+	encodings := []*base64.Encoding{
+		base64.RawURLEncoding,
+		base64.URLEncoding,
+		base64.StdEncoding,
+	}
+	for _, enc := range encodings {
+		signer := Signer{
+			Secret:   bytes.Repeat([]byte("a"), 32),
+			TTL:      time.Hour,
+			Encoding: enc,
+		}
+		for _, payload := range []string{"", "a", "a@b.c", "\xff\xfe\xfd\xfc"} {
+			ensure.True(t, LooksLikeToken(signer.Gen([]byte(payload)), enc), payload)
+		}
+		gen := signer.Gen([]byte("a@b.c"))
+		ensure.False(t, LooksLikeToken(gen[:40], enc))
+		ensure.False(t, LooksLikeToken(append(gen, '!'), enc))
+		ensure.False(t, LooksLikeToken(bytes.Repeat([]byte(" "), 100), enc))
+	}
+
+	// URL safe and standard alphabets differ.
+	ensure.False(t, LooksLikeToken(bytes.Repeat([]byte("-"), 100), base64.StdEncoding))
+	ensure.False(t, LooksLikeToken(bytes.Repeat([]byte("+"), 100), base64.RawURLEncoding))
+	ensure.False(t, LooksLikeToken(bytes.Repeat([]byte("="), 100), base64.RawURLEncoding))
+	ensure.True(t, LooksLikeToken(bytes.Repeat([]byte("-_"), 50), base64.RawURLEncoding))
+}
+
+func TestTolerantDecode(t *testing.T) {
+	signer := Signer{
+		Secret:         bytes.Repeat([]byte("a"), 32),
+		TTL:            time.Hour,
+		TolerantDecode: true,
+	}
+	payload := []byte("abc")
+	gen := string(signer.Gen(payload))
+	ensure.DeepEqual(t, len(gen)%4, 2)
+
+	for _, b := range []string{gen, gen + "=="} {
+		actual, err := signer.Parse([]byte(b))
+		ensure.Nil(t, err, b)
+		ensure.DeepEqual(t, actual, payload)
+	}
+	for _, b := range []string{gen + "=", gen + "===", gen[:10] + "==" + gen[10:]} {
+		_, err := signer.Parse([]byte(b))
+		ensure.NotNil(t, err, b)
+	}
+
+	strict := signer
+	strict.TolerantDecode = false
+	_, err := strict.Parse([]byte(gen + "=="))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+
+	// With a Delimiter each part is padded on its own.
+	signer.Delimiter = '.'
+	signer.Encoding = base64.RawStdEncoding
+	gen = string(signer.Gen([]byte("a@b.c")))
+	parts := strings.Split(gen, ".")
+	padded := parts[0] + "==." + parts[1] + "="
+	actual, err := signer.Parse([]byte(padded))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual, []byte("a@b.c"))
+	actual, err = signer.Parse([]byte(parts[0] + "." + parts[1] + "="))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, actual, []byte("a@b.c"))
+	_, err = signer.Parse([]byte(parts[0] + "=." + parts[1]))
+	ensure.NotNil(t, err)
+
+	// Padding is only tolerated for unpadded base64.
+	signer.Delimiter = 0
+	signer.Encoding = Base32Encoding
+	gen = string(signer.Gen(payload))
+	_, err = signer.Parse([]byte(gen + "=="))
+	ensure.NotNil(t, err)
+}
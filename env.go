@@ -0,0 +1,81 @@
+package hmacsigner
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FromEnv returns a validated Signer configured by environment variables
+// with the given prefix:
+//
+//	PREFIX_SECRET    the secret, in hex or base64 (required)
+//	PREFIX_TTL       the TTL, as parsed by time.ParseDuration (required)
+//	PREFIX_ENCODING  an encoding name as used by Config (optional)
+//	PREFIX_HASH      the hash, which must be sha256 (optional)
+//
+// A secret that is valid hex is decoded as hex, otherwise standard and URL
+// base64 are accepted, with or without padding.
+func FromEnv(prefix string) (*Signer, error) {
+	env := func(name string) (string, string) {
+		name = prefix + "_" + name
+		return name, os.Getenv(name)
+	}
+
+	name, value := env("SECRET")
+	if value == "" {
+		return nil, fmt.Errorf("hmacsigner: %v is not set", name)
+	}
+	secret, err := decodeSecret(value)
+	if err != nil {
+		return nil, fmt.Errorf("hmacsigner: %v is neither hex nor base64", name)
+	}
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("hmacsigner: %v: %w", name, ErrSecretTooShort)
+	}
+
+	name, value = env("TTL")
+	if value == "" {
+		return nil, fmt.Errorf("hmacsigner: %v is not set", name)
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("hmacsigner: %v: %w", name, err)
+	}
+
+	s := &Signer{Secret: secret, TTL: ttl}
+	if name, value := env("ENCODING"); value != "" {
+		if s.Encoding, err = encodingByName(value); err != nil {
+			return nil, fmt.Errorf("%w in %v", err, name)
+		}
+	}
+	if name, value := env("HASH"); value != "" && value != configHash {
+		return nil, fmt.Errorf("hmacsigner: unsupported hash %q in %v", value, name)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decodeSecret decodes a secret in hex or base64.
+func decodeSecret(s string) ([]byte, error) {
+	if b, err := hex.DecodeString(s); err == nil {
+		return b, nil
+	}
+	var err error
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		var b []byte
+		if b, err = enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
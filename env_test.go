@@ -0,0 +1,86 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func setEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{"TEST_SECRET", "TEST_TTL", "TEST_ENCODING", "TEST_HASH"} {
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		ensure.Nil(t, os.Setenv(name, value))
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	defer setEnv(t, nil)
+	secret := bytes.Repeat([]byte("a"), 32)
+	secrets := []string{
+		hex.EncodeToString(secret),
+		base64.StdEncoding.EncodeToString(secret),
+		base64.RawURLEncoding.EncodeToString(secret),
+	}
+	for _, encoded := range secrets {
+		setEnv(t, map[string]string{
+			"TEST_SECRET": encoded,
+			"TEST_TTL":    "1h",
+		})
+		signer, err := FromEnv("TEST")
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, signer.Secret, secret)
+		ensure.DeepEqual(t, signer.TTL, time.Hour)
+
+		expected := Signer{Secret: secret, TTL: time.Hour}
+		payload, err := expected.Parse(signer.Gen([]byte("a@b.c")))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, payload, []byte("a@b.c"))
+	}
+
+	setEnv(t, map[string]string{
+		"TEST_SECRET":   secrets[0],
+		"TEST_TTL":      "10m",
+		"TEST_ENCODING": "base32-fold",
+		"TEST_HASH":     "sha256",
+	})
+	signer, err := FromEnv("TEST")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, signer.Encoding, Base32Encoding)
+	ensure.DeepEqual(t, signer.TTL, 10*time.Minute)
+}
+
+func TestFromEnvErrors(t *testing.T) {
+	defer setEnv(t, nil)
+	secret := hex.EncodeToString(bytes.Repeat([]byte("a"), 32))
+	cases := []struct {
+		Env   map[string]string
+		Error string
+	}{
+		{map[string]string{"TEST_TTL": "1h"}, "TEST_SECRET is not set"},
+		{map[string]string{"TEST_SECRET": "!!", "TEST_TTL": "1h"}, "neither hex nor base64"},
+		{map[string]string{"TEST_SECRET": "abcd", "TEST_TTL": "1h"}, "TEST_SECRET: .*secret"},
+		{map[string]string{"TEST_SECRET": secret}, "TEST_TTL is not set"},
+		{map[string]string{"TEST_SECRET": secret, "TEST_TTL": "soon"}, "TEST_TTL: .*invalid duration"},
+		{map[string]string{"TEST_SECRET": secret, "TEST_TTL": "-1h"}, "ttl must be positive"},
+		{map[string]string{"TEST_SECRET": secret, "TEST_TTL": "1h", "TEST_ENCODING": "rot13"}, "unsupported encoding.*TEST_ENCODING"},
+		{map[string]string{"TEST_SECRET": secret, "TEST_TTL": "1h", "TEST_HASH": "md5"}, "unsupported hash.*TEST_HASH"},
+	}
+	for _, c := range cases {
+		setEnv(t, c.Env)
+		_, err := FromEnv("TEST")
+		ensure.Err(t, err, regexp.MustCompile(c.Error))
+	}
+
+	setEnv(t, map[string]string{"TEST_SECRET": "abcd", "TEST_TTL": "1h"})
+	_, err := FromEnv("TEST")
+	ensure.True(t, errors.Is(err, ErrSecretTooShort))
+}
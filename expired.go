@@ -0,0 +1,21 @@
+package hmacsigner
+
+import "time"
+
+// ExpiredError is returned for tokens with a valid signature which have
+// expired. It matches ErrTimestampExpired with errors.Is. The times come from
+// the verified header.
+type ExpiredError struct {
+	IssuedAt  time.Time
+	ExpiredAt time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return ErrTimestampExpired.Error() + " at " +
+		e.ExpiredAt.UTC().Format(time.RFC3339Nano)
+}
+
+// Is reports if target is ErrTimestampExpired.
+func (e *ExpiredError) Is(target error) bool {
+	return target == ErrTimestampExpired
+}
@@ -0,0 +1,305 @@
+package hmacsigner
+
+import "encoding/binary"
+
+// Version 0 headers predate the salt, and are only accepted when
+// LegacyNoSalt is set. They are never generated.
+const (
+	versionNoSalt   = byte(0)
+	noSaltHeaderLen = versionLen + issueLen + sigLen
+)
+
+// Version 2 headers follow the version with a little endian bitset of flags.
+// Each flag adds a fixed size field, in flag order, between the salt and the
+// signature. Tokens that need none of them are generated as version 1.
+const (
+	flagNotBefore uint16 = 1 << iota
+	flagSegments
+	flagSchema
+	flagAAD
+	flagAudience
+	flagGeneration
+	flagEmpty
+	flagFingerprint
+	flagContentType
+	flagKeyID
+	flagLength
+	flagIssuer
+)
+
+const knownFlags = flagNotBefore | flagSegments | flagSchema | flagAAD |
+	flagAudience | flagGeneration | flagEmpty | flagFingerprint | flagContentType |
+	flagKeyID | flagLength | flagIssuer
+
+// Version 3 headers are laid out like version 2 ones, but the signature
+// follows the encoded payload instead of the header, so the token can be
+// written and verified in a single pass. They are generated with TrailingSig.
+const versionTrailing = byte(3)
+
+const (
+	versionFlags   = byte(2)
+	flagsLen       = 2
+	notBeforeLen   = 8
+	schemaLen      = 1
+	audienceLen    = 8
+	generationLen  = 1
+	fingerprintLen = 2
+	contentTypeLen = 1
+	keyIDLen       = 1
+	lengthLen      = 4
+	issuerLen      = 1
+	prefixLen      = versionLen + flagsLen
+	maxHeaderLen   = versionLen + flagsLen + issueLen + saltLen + notBeforeLen +
+		schemaLen + audienceLen + generationLen + fingerprintLen +
+		contentTypeLen + keyIDLen + lengthLen + issuerLen + sigLen
+)
+
+// header is the decoded form of the token header.
+type header struct {
+	version     byte
+	flags       uint16
+	issue       int64
+	salt        [saltLen]byte
+	notBefore   int64
+	schema      byte
+	audience    [audienceLen]byte
+	generation  byte
+	fingerprint [fingerprintLen]byte
+	contentType byte
+	keyID       byte
+	length      uint32
+	issuer      byte
+}
+
+// hasFlags reports if the header includes flags.
+func (h *header) hasFlags() bool {
+	return h.version == versionFlags || h.version == versionTrailing
+}
+
+// signedLen returns the length of the header excluding the signature.
+func (h *header) signedLen() int {
+	switch h.version {
+	case version:
+		return sigOffset
+	case versionNoSalt:
+		return versionLen + issueLen
+	}
+	n := prefixLen + issueLen + saltLen
+	if h.flags&flagNotBefore != 0 {
+		n += notBeforeLen
+	}
+	if h.flags&flagSchema != 0 {
+		n += schemaLen
+	}
+	if h.flags&flagAudience != 0 {
+		n += audienceLen
+	}
+	if h.flags&flagGeneration != 0 {
+		n += generationLen
+	}
+	if h.flags&flagFingerprint != 0 {
+		n += fingerprintLen
+	}
+	if h.flags&flagContentType != 0 {
+		n += contentTypeLen
+	}
+	if h.flags&flagKeyID != 0 {
+		n += keyIDLen
+	}
+	if h.flags&flagLength != 0 {
+		n += lengthLen
+	}
+	if h.flags&flagIssuer != 0 {
+		n += issuerLen
+	}
+	return n
+}
+
+// marshal writes the header excluding the signature into b, which must be
+// at least signedLen bytes.
+func (h *header) marshal(b []byte) {
+	b[0] = h.version
+	b = b[versionLen:]
+
+	if h.hasFlags() {
+		binary.LittleEndian.PutUint16(b, h.flags)
+		b = b[flagsLen:]
+	}
+
+	binary.LittleEndian.PutUint64(b, uint64(h.issue))
+	b = b[issueLen:]
+
+	if h.version == versionNoSalt {
+		return
+	}
+	copy(b, h.salt[:])
+	b = b[saltLen:]
+
+	if h.flags&flagNotBefore != 0 {
+		binary.LittleEndian.PutUint64(b, uint64(h.notBefore))
+		b = b[notBeforeLen:]
+	}
+
+	if h.flags&flagSchema != 0 {
+		b[0] = h.schema
+		b = b[schemaLen:]
+	}
+
+	if h.flags&flagAudience != 0 {
+		copy(b, h.audience[:])
+		b = b[audienceLen:]
+	}
+
+	if h.flags&flagGeneration != 0 {
+		b[0] = h.generation
+		b = b[generationLen:]
+	}
+
+	if h.flags&flagFingerprint != 0 {
+		copy(b, h.fingerprint[:])
+		b = b[fingerprintLen:]
+	}
+
+	if h.flags&flagContentType != 0 {
+		b[0] = h.contentType
+		b = b[contentTypeLen:]
+	}
+
+	if h.flags&flagKeyID != 0 {
+		b[0] = h.keyID
+		b = b[keyIDLen:]
+	}
+
+	if h.flags&flagLength != 0 {
+		binary.LittleEndian.PutUint32(b, h.length)
+		b = b[lengthLen:]
+	}
+
+	if h.flags&flagIssuer != 0 {
+		b[0] = h.issuer
+	}
+}
+
+// unmarshal reads the header excluding the signature from b. The version and
+// flags must already be set.
+func (h *header) unmarshal(b []byte) {
+	b = b[versionLen:]
+	if h.hasFlags() {
+		b = b[flagsLen:]
+	}
+
+	h.issue = int64(binary.LittleEndian.Uint64(b))
+	b = b[issueLen:]
+
+	if h.version == versionNoSalt {
+		return
+	}
+	copy(h.salt[:], b)
+	b = b[saltLen:]
+
+	if h.flags&flagNotBefore != 0 {
+		h.notBefore = int64(binary.LittleEndian.Uint64(b))
+		b = b[notBeforeLen:]
+	}
+
+	if h.flags&flagSchema != 0 {
+		h.schema = b[0]
+		b = b[schemaLen:]
+	}
+
+	if h.flags&flagAudience != 0 {
+		copy(h.audience[:], b)
+		b = b[audienceLen:]
+	}
+
+	if h.flags&flagGeneration != 0 {
+		h.generation = b[0]
+		b = b[generationLen:]
+	}
+
+	if h.flags&flagFingerprint != 0 {
+		copy(h.fingerprint[:], b)
+		b = b[fingerprintLen:]
+	}
+
+	if h.flags&flagContentType != 0 {
+		h.contentType = b[0]
+		b = b[contentTypeLen:]
+	}
+
+	if h.flags&flagKeyID != 0 {
+		h.keyID = b[0]
+		b = b[keyIDLen:]
+	}
+
+	if h.flags&flagLength != 0 {
+		h.length = binary.LittleEndian.Uint32(b)
+		b = b[lengthLen:]
+	}
+
+	if h.flags&flagIssuer != 0 {
+		h.issuer = b[0]
+	}
+}
+
+// readPrefix reads the version and flags at the start of b, which must be
+// at least prefixLen bytes.
+func readPrefix(b []byte) (byte, uint16, error) {
+	v := b[0]
+	switch v {
+	case version, versionNoSalt:
+		return v, 0, nil
+	case versionFlags, versionTrailing:
+		flags := binary.LittleEndian.Uint16(b[versionLen:])
+		if flags&^knownFlags != 0 {
+			return 0, 0, ErrInvalidVersion
+		}
+		return v, flags, nil
+	}
+	return 0, 0, ErrInvalidVersion
+}
+
+// readHeader reads the decoded header in b into h. It returns the length of
+// the header including the signature.
+func readHeader(b []byte, h *header) (int, error) {
+	if len(b) < prefixLen {
+		return 0, ErrTooShort
+	}
+	var err error
+	h.version, h.flags, err = readPrefix(b)
+	if err != nil {
+		return 0, err
+	}
+	n := h.signedLen() + sigLen
+	if len(b) < n {
+		return 0, ErrTooShort
+	}
+	h.unmarshal(b)
+	return n, nil
+}
+
+// decodeHeader decodes the header at the start of b into h and raw, which
+// must be at least maxHeaderLen bytes. It returns the number of bytes of b
+// that were consumed and the decoded length of the header, which excludes a
+// trailing signature.
+func decodeHeader(enc Encoding, b []byte, h *header, raw []byte) (int, int, error) {
+	var err error
+	h.version, h.flags, err = decodePrefix(enc, b)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n := h.signedLen()
+	if h.version != versionTrailing {
+		n += sigLen
+	}
+	encLen := enc.EncodedLen(n)
+	if len(b) < encLen {
+		return 0, 0, ErrTooShort
+	}
+	if _, err := enc.Decode(raw, b[:encLen]); err != nil {
+		return 0, 0, ErrInvalidEncoding
+	}
+	h.unmarshal(raw)
+	return encLen, n, nil
+}
@@ -0,0 +1,51 @@
+package hmacsigner
+
+import "bytes"
+
+// hintSep separates a token from its hint. It is not part of any supported
+// encoding.
+const hintSep = '~'
+
+// GenWithHint is like Gen, but appends the hint encoded with the Encoding
+// after the token, separated by a '~'. The hint is NOT signed: anyone can
+// read it without the secret, and anyone can change it without invalidating
+// the token. Only use it for data that is safe to be forged, such as a cache
+// version, and never trust it. Verifiers need Hints to accept the token.
+func (s *Signer) GenWithHint(payload, hint []byte) []byte {
+	gen := s.Gen(payload)
+	if gen == nil {
+		return nil
+	}
+	enc := s.encoding()
+	out := make([]byte, len(gen)+1+enc.EncodedLen(len(hint)))
+	n := copy(out, gen)
+	out[n] = hintSep
+	enc.Encode(out[n+1:], hint)
+	return out
+}
+
+// Hint returns the hint of a token generated by GenWithHint, or nil if it has
+// none. It does no verification, and the hint is untrusted data even if the
+// token is valid.
+func (s *Signer) Hint(b []byte) []byte {
+	i := bytes.IndexByte(b, hintSep)
+	if i < 0 {
+		return nil
+	}
+	enc := s.encoding()
+	src := b[i+1:]
+	hint := make([]byte, enc.DecodedLen(len(src)))
+	n, err := enc.Decode(hint, src)
+	if err != nil {
+		return nil
+	}
+	return hint[:n]
+}
+
+// stripHint returns b without the hint.
+func stripHint(b []byte) []byte {
+	if i := bytes.IndexByte(b, hintSep); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
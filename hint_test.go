@@ -0,0 +1,55 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestHint(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		Hints:  true,
+	}
+	gen := signer.GenWithHint([]byte("a@b.c"), []byte("v2"))
+	ensure.DeepEqual(t, signer.Hint(gen), []byte("v2"))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	// The hint is not signed.
+	i := bytes.IndexByte(gen, '~')
+	forged := append(append([]byte(nil), gen[:i+1]...), "djk"...)
+	ensure.DeepEqual(t, signer.Hint(forged), []byte("v9"))
+	payload, err = signer.Parse(forged)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	ensure.True(t, signer.Hint(signer.Gen([]byte("a@b.c"))) == nil)
+	ensure.DeepEqual(t, signer.Hint(signer.GenWithHint(nil, nil)), []byte{})
+
+	// Hints are rejected unless enabled, so tokens have a single form.
+	strict := signer
+	strict.Hints = false
+	_, err = strict.Parse(gen)
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+}
+
+func TestHintEncoding(t *testing.T) {
+	signer := Signer{
+		Secret:   bytes.Repeat([]byte("a"), 32),
+		TTL:      time.Hour,
+		Encoding: Base32Encoding,
+		Hints:    true,
+	}
+	gen := signer.GenWithHint([]byte("a@b.c"), []byte("v2"))
+	i := bytes.IndexByte(gen, '~')
+	ensure.DeepEqual(t, string(gen[i+1:]), "OYZA")
+	ensure.DeepEqual(t, signer.Hint(gen), []byte("v2"))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+}
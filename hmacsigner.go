@@ -18,13 +18,17 @@
 package hmacsigner
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"hash"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,6 +43,9 @@ const (
 	minSecretLen = 32
 )
 
+// RecommendedSecretLen is the secret length below which Gen logs a warning.
+const RecommendedSecretLen = 64
+
 var (
 	// ErrTooShort indicates the data to parse is too short to be valid.
 	ErrTooShort = errors.New("hmacsigner: too short")
@@ -49,20 +56,327 @@ var (
 	// ErrInvalidEncoding indicates the encoding is invalid.
 	ErrInvalidEncoding = errors.New("hmacsigner: invalid encoding")
 
-	// ErrTimestampExpired indicates the timestamp has expired.
+	// ErrTimestampExpired indicates the timestamp has expired. Parse returns
+	// it as an *ExpiredError.
 	ErrTimestampExpired = errors.New("hmacsigner: timestamp expired")
 
 	// ErrSignatureMismatch indicates the signature is not as expected.
 	ErrSignatureMismatch = errors.New("hmacsigner: signature mismatch")
 
+	// ErrSecretTooShort indicates the secret is less than 32 bytes.
+	ErrSecretTooShort = errors.New("hmacsigner: secret too short")
+
+	// ErrTokenTooLong indicates the data to parse is longer than MaxTokenLen.
+	ErrTokenTooLong = errors.New("hmacsigner: token too long")
+
+	// ErrClockWentBackwards indicates the clock returned an earlier time than
+	// one previously used to generate a token.
+	ErrClockWentBackwards = errors.New("hmacsigner: clock went backwards")
+
+	// ErrWrongAudience indicates the token was generated for a different
+	// audience.
+	ErrWrongAudience = errors.New("hmacsigner: wrong audience")
+
+	// ErrNotYetValid indicates the not before timestamp is in the future.
+	ErrNotYetValid = errors.New("hmacsigner: not yet valid")
+
+	// ErrWrongSecret indicates the token carries the fingerprint of a
+	// different secret, which usually means a misconfiguration.
+	ErrWrongSecret = errors.New("hmacsigner: wrong secret")
+
+	// ErrStaleGeneration indicates the token was generated with a Generation
+	// below MinGeneration.
+	ErrStaleGeneration = errors.New("hmacsigner: stale generation")
+
+	// ErrUnexpectedSalt indicates the token has a salt rejected by
+	// ExpectSalt.
+	ErrUnexpectedSalt = errors.New("hmacsigner: unexpected salt")
+
+	// ErrGenDisabled indicates a token was requested from a VerifyOnly
+	// Signer.
+	ErrGenDisabled = errors.New("hmacsigner: generation disabled")
+
+	// ErrTimestampImplausible indicates the token claims to have been issued
+	// before the Epoch, or before EarliestValid.
+	ErrTimestampImplausible = errors.New("hmacsigner: timestamp implausible")
+
+	// ErrTTLTooShort indicates the token is valid for less than
+	// MinAcceptedTTL.
+	ErrTTLTooShort = errors.New("hmacsigner: ttl too short")
+
+	// ErrTruncated indicates the token is shorter than the length in its
+	// header. Like other malformed tokens it has not been verified, so it
+	// is only a hint of the token being cut short in transport.
+	ErrTruncated = errors.New("hmacsigner: token truncated")
+
+	// ErrUnknownIssuer indicates the Issuer of the token is not one of the
+	// AllowedIssuers.
+	ErrUnknownIssuer = errors.New("hmacsigner: unknown issuer")
+
 	encHeaderLen = base64.RawURLEncoding.EncodedLen(headerLen)
 )
 
 // Signer handles generating and parsing signed data.
+//
+// Tokens only carry their issue time, and the TTL is applied by Parse.
+// Changing it changes the expiry of previously issued tokens too.
 type Signer struct {
+	// lastIssue is the latest issue time used by Gen. It is accessed
+	// atomically, and kept first for 64-bit alignment.
+	lastIssue int64
+
+	// saltCounter is the last salt used with GuaranteedUniqueSalt. It is
+	// accessed atomically.
+	saltCounter uint64
+
+	// warnedShort is set once Logf was told of a short secret. It is
+	// accessed atomically.
+	warnedShort uint32
+
 	Secret []byte        // Secret must be at least 32 bytes.
 	TTL    time.Duration // TTL must be non zero.
 
+	// PreviousTTL, if longer than the TTL, is also accepted by Parse. It
+	// smooths shortening the TTL, since tokens issued with the previous one
+	// stay valid for as long as they were promised. Tokens do not record
+	// their TTL, so it applies to new tokens too, and should be removed once
+	// the old tokens have expired.
+	PreviousTTL time.Duration
+
+	// SecretProvider, if set, is used instead of Secret.
+	SecretProvider SecretProvider
+
+	// KeyID, if non zero, is included in the header of tokens generated by
+	// Gen, and passed to the ResolveSecret of the verifier.
+	KeyID byte
+
+	// ResolveSecret, if set, is called by Parse with the KeyID of the token,
+	// zero if it has none, and the secret it returns is the only one
+	// accepted, instead of Secret or SecretProvider. It allows verifying
+	// tokens from many tenants with their own secrets. The KeyID is not
+	// authenticated until the signature is verified using the secret, so
+	// ResolveSecret must not have side effects. Its errors are returned by
+	// Parse.
+	ResolveSecret func(keyID byte) ([]byte, error)
+
+	// Issuer, if non zero, identifies the service generating tokens, and is
+	// included in their header. Unlike the KeyID it does not select the
+	// secret, and is only checked once the token is verified.
+	Issuer byte
+
+	// AllowedIssuers, if not nil, makes Parse reject tokens whose Issuer is
+	// not one of them with ErrUnknownIssuer. Tokens without an Issuer have
+	// an Issuer of zero.
+	AllowedIssuers []byte
+
+	// VerifyOnly makes Gen panic with ErrGenDisabled, or return nil if
+	// PanicOnMisconfig is false, for services which must never issue tokens.
+	VerifyOnly bool
+
+	// Pepper, if set, is combined with the secret using HMAC to form the
+	// key. It allows keeping part of the key material in a different place,
+	// such as an HSM, so that neither alone allows forging tokens.
+	Pepper []byte
+
+	// BootID, if set, is mixed into the key, so tokens are only accepted by
+	// Signers with the same BootID. Setting it to random bytes at startup
+	// invalidates all tokens issued before a restart, without changing the
+	// Secret.
+	BootID []byte
+
+	// Fingerprint makes Gen include a 2 byte fingerprint of the key in the
+	// header, which allows Parse to report a token signed with a different
+	// secret as ErrWrongSecret rather than ErrSignatureMismatch. It reveals
+	// 2 bytes of a hash of the key, and the fingerprint is only checked
+	// before the signature, so a forger can also trigger ErrWrongSecret.
+	Fingerprint bool
+
+	// StretchSecret derives the HMAC key from the secret using PBKDF2 with
+	// a fixed salt, raising the cost of brute forcing a low entropy secret.
+	// It is a mitigation, and no substitute for a random secret. Tokens are
+	// not interchangeable between stretched and unstretched Signers. The
+	// derived key is cached, so the cost is paid once per secret. With
+	// ResolveSecret, the secrets of every KeyID are stretched on first use.
+	StretchSecret bool
+
+	// RefreshTTL is the TTL of refresh tokens generated by GenRefresh, and
+	// accepted by Exchange. Without it Exchange returns ErrInvalidTTL.
+	RefreshTTL time.Duration
+
+	// Leeway is the clock skew tolerated by Parse, both past the expiry and
+	// before the not before time of a token. It must be less than the TTL.
+	Leeway time.Duration
+
+	// PastLeeway and FutureLeeway, if non zero, replace the Leeway past the
+	// expiry and before the not before time respectively. A non zero
+	// FutureLeeway also makes Parse reject tokens issued further than it in
+	// the future with ErrNotYetValid. The PastLeeway must be less than the
+	// TTL.
+	PastLeeway   time.Duration
+	FutureLeeway time.Duration
+
+	// SchemaVersion, if non zero, is included in the signed header of tokens
+	// generated by Gen. It allows applications to evolve their payload format
+	// independently of the token format, and is returned by ParseSchema.
+	SchemaVersion byte
+
+	// ContentType, if non zero, is included in the signed header of tokens
+	// generated by Gen, and identifies how the payload is encoded, such as
+	// JSON or protobuf. Its values are up to the application. ParseFull
+	// returns it, leaving the caller to reject unexpected types.
+	ContentType byte
+
+	// Audience, if set, scopes tokens to a named audience. Gen includes a
+	// hash of it in the signed header, and Parse rejects tokens generated for
+	// a different audience, or none, with ErrWrongAudience.
+	Audience string
+
+	// Generation, if non zero, is included in the signed header of tokens
+	// generated by Gen. Parse rejects tokens with a Generation below
+	// MinGeneration with ErrStaleGeneration, so bumping MinGeneration
+	// invalidates all older tokens without changing the Secret.
+	Generation    byte
+	MinGeneration byte
+
+	// Epoch, if set, is the time timestamps in tokens are relative to, and
+	// defaults to the Unix epoch. Tokens can only be verified by a Signer
+	// using the same Epoch.
+	Epoch time.Time
+
+	// EarliestValid, if set, makes Parse reject tokens issued before it with
+	// ErrTimestampImplausible, regardless of the TTL. It guards against
+	// corrupt timestamps being accepted due to a misconfigured TTL.
+	EarliestValid time.Time
+
+	// MinAcceptedTTL, if set, makes Parse reject tokens valid for less than
+	// it with ErrTTLTooShort. Tokens are valid from the later of their issue
+	// and not before times until they expire, so it catches issuers setting
+	// a not before time too close to the expiry. It must not exceed the TTL.
+	MinAcceptedTTL time.Duration
+
+	// ReplayFilter, if set, makes Parse reject tokens it has probably
+	// verified before with ErrReplayed. Every successful verification counts,
+	// including those by ParseFull, ExpiresAt and the like.
+	ReplayFilter *ReplayFilter
+
+	// DefaultPayload is signed by GenDefault and expected by
+	// ParseExpectDefault, for fixed payload tokens such as health checks.
+	DefaultPayload []byte
+
+	// KeyPeriod, if set, makes Gen sign using a key derived from the secret
+	// for the period containing the time of issue. Parse accepts the keys for
+	// the current and previous periods, along with the next one within
+	// the FutureLeeway of it. The TTL plus the PastLeeway must not exceed the
+	// KeyPeriod.
+	KeyPeriod time.Duration
+
+	// Encoding is used by Gen and tried first by Parse. Defaults to
+	// base64.RawURLEncoding.
+	Encoding Encoding
+
+	// Delimiter, if non zero, separates the encoded header and payload. It
+	// must not be part of the alphabet of the Encoding. Parse rejects tokens
+	// without it with ErrInvalidEncoding. Using '.' gives tokens the familiar
+	// two part shape of a JWT, though they are not JWTs.
+	Delimiter byte
+
+	// LegacyEncodings are also accepted by Parse, in order, which allows
+	// changing the Encoding without breaking issued tokens.
+	LegacyEncodings []Encoding
+
+	// URLBudget is the maximum token length FitsURL accepts. Defaults to
+	// DefaultURLBudget.
+	URLBudget int
+
+	// Codec is used by GenValue and ParseValue. Defaults to JSONCodec.
+	Codec PayloadCodec
+
+	// EmbedLength makes Gen include the length of the payload in the signed
+	// header, which allows ParseReader to read a token from a stream without
+	// any framing, and Parse to report truncated tokens with ErrTruncated.
+	// Payloads must be shorter than 4GiB.
+	EmbedLength bool
+
+	// TrailingSig makes Gen generate version 3 tokens, where the signature
+	// follows the payload instead of the header. Producers can then write
+	// the token as they sign it, and consumers verify it as they read it.
+	// Parse accepts both layouts regardless.
+	TrailingSig bool
+
+	// TolerantDecode makes Parse accept tokens with the base64 padding some
+	// clients add, at the end of the token and before the Delimiter. It
+	// applies to the unpadded base64 encodings, and only padding of the
+	// length the padded encoding would have is removed. Gen never pads.
+	TolerantDecode bool
+
+	// Hints makes Parse ignore the unsigned hint appended by GenWithHint.
+	// Since the hint can be changed freely, a token then has many valid
+	// forms, so anything keyed on the token string, such as a revocation
+	// list or a cache, must strip the hint first. Without it tokens with a
+	// hint are rejected.
+	Hints bool
+
+	// MaxTokenLen, if non zero, is the longest token Parse will consider.
+	// Longer input is rejected before any decoding or allocation.
+	MaxTokenLen int
+
+	// MinVersion and MaxVersion, if non zero, restrict the token format
+	// versions accepted by Parse to the range between them. Versions outside
+	// it are rejected with ErrInvalidVersion.
+	MinVersion byte
+	MaxVersion byte
+
+	// LegacyNoSalt makes Parse accept version 0 tokens, generated before
+	// tokens included a salt. It is a migration aid, and will be removed once
+	// such tokens have expired.
+	LegacyNoSalt bool
+
+	// UniformTiming makes Parse compute an HMAC over a buffer of equivalent
+	// size when it rejects a token before checking its signature, making
+	// malformed input take as long as a bad signature. This costs CPU on
+	// garbage input.
+	UniformTiming bool
+
+	// RejectClockRegression makes Gen panic with ErrClockWentBackwards if the
+	// clock returns a time before one it already used, which guards the
+	// uniqueness of issue times. When PanicOnMisconfig is false Gen returns
+	// nil instead, and SafeGen the error.
+	RejectClockRegression bool
+
+	// GuaranteedUniqueSalt makes Gen use a counter starting at a random
+	// value as the salt, instead of random bytes. Salts are then distinct for
+	// every token generated by the Signer, regardless of the clock or the
+	// random source. Copies made by WithTTL start a new counter.
+	GuaranteedUniqueSalt bool
+
+	// ExpectSalt, if set, is called by Parse with the salt of every authentic
+	// token, and tokens it returns false for are rejected with
+	// ErrUnexpectedSalt. It is a testing aid, which catches tokens generated
+	// with random salts in tests that expect deterministic ones, such as
+	// those from WithSeed.
+	ExpectSalt func(salt [saltLen]byte) bool
+
+	// Logf, if set, receives warnings about the configuration, such as a
+	// secret shorter than RecommendedSecretLen. Each is logged once per
+	// Signer. The signature matches log.Printf.
+	Logf func(format string, v ...interface{})
+
+	// OnGen, if set, is called with the salt and issue time of every token
+	// generated, which allows recording them to revoke tokens later. It runs
+	// synchronously before the token is returned, so it should be fast.
+	OnGen func(salt [saltLen]byte, issued time.Time)
+
+	// OnNearExpiry, if set, is called by Parse with the remaining lifetime of
+	// a valid token that expires within NearExpiry. It allows prompting for a
+	// refresh.
+	OnNearExpiry func(remaining time.Duration)
+	NearExpiry   time.Duration
+
+	// Metrics, if set, is told the outcome of every Parse.
+	Metrics Metrics
+
+	stretched atomic.Value // []stretched
+
 	nowF  func() time.Time
 	saltF func([]byte)
 }
@@ -74,7 +388,27 @@ func (s *Signer) now() time.Time {
 	return s.nowF()
 }
 
+// stamp returns t as stored in a token.
+func (s *Signer) stamp(t time.Time) int64 {
+	if s.Epoch.IsZero() {
+		return t.UnixNano()
+	}
+	return t.UnixNano() - s.Epoch.UnixNano()
+}
+
+// time returns the time for a timestamp stored in a token.
+func (s *Signer) time(stamp int64) time.Time {
+	if s.Epoch.IsZero() {
+		return time.Unix(0, stamp)
+	}
+	return time.Unix(0, s.Epoch.UnixNano()+stamp)
+}
+
 func (s *Signer) salt(b []byte) {
+	if s.GuaranteedUniqueSalt {
+		binary.LittleEndian.PutUint64(b, s.nextSalt())
+		return
+	}
 	if s.saltF == nil {
 		if _, err := rand.Read(b); err != nil {
 			panic(err)
@@ -84,86 +418,846 @@ func (s *Signer) salt(b []byte) {
 	s.saltF(b)
 }
 
-func (s *Signer) sign(
+// nextSalt returns the next value of the salt counter, starting it at a
+// random value.
+func (s *Signer) nextSalt() uint64 {
+	if atomic.LoadUint64(&s.saltCounter) == 0 {
+		var start [8]byte
+		if s.saltF == nil {
+			if _, err := rand.Read(start[:]); err != nil {
+				panic(err)
+			}
+		} else {
+			s.saltF(start[:])
+		}
+		atomic.CompareAndSwapUint64(&s.saltCounter, 0,
+			binary.LittleEndian.Uint64(start[:]))
+	}
+	return atomic.AddUint64(&s.saltCounter, 1)
+}
+
+// newMAC returns a MAC which has been written everything preceding the
+// payload.
+func newMAC(secret, header []byte, aad []aadPart) hash.Hash {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(header)
+	if aad != nil {
+		writeAAD(mac, aad)
+	}
+	return mac
+}
+
+// macSet computes the MAC of the same data under each accepted secret.
+type macSet []hash.Hash
+
+// newMACs returns a macSet which has been written everything preceding the
+// payload.
+func (s *Signer) newMACs(
+	h *header,
+	header []byte,
+	aad []aadPart,
+	now time.Time,
+) (macSet, error) {
+	secrets, err := s.secrets(h, now)
+	if err != nil {
+		return nil, err
+	}
+	macs := make(macSet, len(secrets))
+	for i, secret := range secrets {
+		macs[i] = newMAC(secret, header, aad)
+	}
+	return macs, nil
+}
+
+func (m macSet) Write(b []byte) (int, error) {
+	for _, mac := range m {
+		mac.Write(b)
+	}
+	return len(b), nil
+}
+
+// matches reports if any of the MACs equals sig.
+func (m macSet) matches(sig []byte) bool {
+	var expectedSig [sigLen]byte
+	for _, mac := range m {
+		if hmac.Equal(mac.Sum(expectedSig[:0]), sig) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(
+	secret []byte,
 	header []byte,
+	aad []aadPart,
 	payload []byte,
 	sig []byte,
 ) {
-	mac := hmac.New(sha256.New, s.Secret)
-	mac.Write(header)
+	mac := newMAC(secret, header, aad)
 	mac.Write(payload)
 	mac.Sum(sig)
 }
 
-// Gen returns the signed payload.
+// checkClock records issue as the latest issue time. It reports
+// ErrClockWentBackwards if an earlier one has already been seen, and panics
+// with it if PanicOnMisconfig is set.
+func (s *Signer) checkClock(issue int64) error {
+	for {
+		last := atomic.LoadInt64(&s.lastIssue)
+		if issue < last {
+			if !PanicOnMisconfig {
+				return ErrClockWentBackwards
+			}
+			panic(ErrClockWentBackwards)
+		}
+		if atomic.CompareAndSwapInt64(&s.lastIssue, last, issue) {
+			return nil
+		}
+	}
+}
+
+// WithTTL returns a shallow copy of the Signer using the given TTL, without
+// a PreviousTTL. The copy shares the Secret and hooks with the original. It
+// reads the state Gen and Parse update, so it must not be called while the
+// Signer is in use.
+func (s *Signer) WithTTL(ttl time.Duration) *Signer {
+	c := *s
+	c.TTL = ttl
+	c.PreviousTTL = 0
+	c.saltCounter = 0
+	return &c
+}
+
+// acceptedTTL returns the longest TTL accepted by Parse.
+func (s *Signer) acceptedTTL() time.Duration {
+	if s.PreviousTTL > s.TTL {
+		return s.PreviousTTL
+	}
+	return s.TTL
+}
+
+// tokenTTL returns the longest TTL accepted for t.
+func (s *Signer) tokenTTL(t *token) time.Duration {
+	if t.ttl != 0 {
+		return t.ttl
+	}
+	return s.acceptedTTL()
+}
+
+// burn computes an HMAC as expensive as verifying a token of length n, and
+// discards it.
+func (s *Signer) burn(n int) {
+	var zero [512]byte
+	mac := hmac.New(sha256.New, s.Secret)
+	for n = s.encoding().DecodedLen(n); n > 0; n -= len(zero) {
+		if n < len(zero) {
+			mac.Write(zero[:n])
+			break
+		}
+		mac.Write(zero[:])
+	}
+	var sig [sigLen]byte
+	mac.Sum(sig[:0])
+}
+
+// Gen returns the signed payload. It panics if the secret is too short or
+// the Signer is VerifyOnly, unless PanicOnMisconfig is false, in which case
+// it returns nil.
 func (s *Signer) Gen(payload []byte) []byte {
-	if len(s.Secret) < minSecretLen {
-		panic(fmt.Sprintf("secret less than %v bytes", minSecretLen))
+	return genOrNil(s.gen(&header{}, nil, payload))
+}
+
+// GenNotBefore returns the signed payload, which Parse will reject with
+// ErrNotYetValid until notBefore. The TTL still counts from the time of
+// issue.
+func (s *Signer) GenNotBefore(payload []byte, notBefore time.Time) []byte {
+	return genOrNil(s.gen(&header{
+		flags:     flagNotBefore,
+		notBefore: s.stamp(notBefore),
+	}, nil, payload))
+}
+
+// GenAt is like Gen, but for a token issued at issue instead of the current
+// time, which allows backfilling tokens or creating precise fixtures. The
+// token expires a TTL after issue, and RejectClockRegression does not apply.
+// A zero issue means the current time.
+func (s *Signer) GenAt(payload []byte, issue time.Time) []byte {
+	return genOrNil(s.appendGenAt(nil, &header{}, nil, payload, issue))
+}
+
+// AppendGen appends the signed payload to dst and returns the extended
+// buffer. Reusing dst avoids allocating for every token.
+func (s *Signer) AppendGen(dst, payload []byte) []byte {
+	gen, _ := s.appendGen(dst, &header{}, nil, payload)
+	return gen
+}
+
+// AppendGenString is like AppendGen, and is meant for incrementally building
+// text such as response bodies or headers. The appended token is printable
+// for the Encodings in this package, and safe to convert to a string.
+func (s *Signer) AppendGenString(dst, payload []byte) []byte {
+	return s.AppendGen(dst, payload)
+}
+
+// gen returns the signed payload using h, which may have any flags and
+// their fields set. If aad is not nil it is included in the signature. It
+// returns an error instead of a token when Gen would return nil.
+func (s *Signer) gen(h *header, aad []aadPart, payload []byte) ([]byte, error) {
+	return s.appendGen(nil, h, aad, payload)
+}
+
+// genOrNil returns gen, or nil if generating it failed, as the public Gen
+// methods do.
+func genOrNil(gen []byte, err error) []byte {
+	if err != nil {
+		return nil
+	}
+	return gen
+}
+
+// appendGen is like gen, but appends the token to dst, which is returned
+// unchanged along with any error.
+func (s *Signer) appendGen(dst []byte, h *header, aad []aadPart, payload []byte) ([]byte, error) {
+	return s.appendGenAt(dst, h, aad, payload, time.Time{})
+}
+
+// appendGenAt is like appendGen, but for tokens issued at issue unless it is
+// zero.
+func (s *Signer) appendGenAt(
+	dst []byte,
+	h *header,
+	aad []aadPart,
+	payload []byte,
+	issue time.Time,
+) ([]byte, error) {
+	if payload != nil && len(payload) == 0 {
+		h.flags |= flagEmpty
+	}
+	h.length = uint32(len(payload))
+	secret, err := s.signingSecret()
+	if err != nil {
+		return dst, err
+	}
+	if s.Fingerprint {
+		h.fingerprint = keyFingerprint(secret)
+	}
+	raw, n, err := s.newHeader(h, aad, issue)
+	if err != nil {
+		return dst, err
+	}
+	secret = s.periodKey(secret, s.time(h.issue))
+	sign(secret, raw[:n], aad, payload, raw[n:n])
+	s.issued(h)
+	return s.appendToken(dst, h, raw[:], n, payload), nil
+}
+
+// issued calls OnGen for the generated token with the header h.
+func (s *Signer) issued(h *header) {
+	if s.OnGen != nil {
+		s.OnGen(h.salt, s.time(h.issue))
+	}
+}
+
+// newHeader completes h for a new token issued at issue, or now if it is
+// zero, and returns it marshaled along with its length excluding the
+// signature. Only tokens issued now are checked for clock regressions.
+func (s *Signer) newHeader(h *header, aad []aadPart, issue time.Time) ([maxHeaderLen]byte, int, error) {
+	var raw [maxHeaderLen]byte
+	s.setFlags(h, aad)
+	if issue.IsZero() {
+		h.issue = s.stamp(s.now())
+		if s.RejectClockRegression {
+			if err := s.checkClock(h.issue); err != nil {
+				return raw, 0, err
+			}
+		}
+	} else {
+		h.issue = s.stamp(issue)
+	}
+	s.salt(h.salt[:])
+
+	n := h.signedLen()
+	h.marshal(raw[:n])
+	return raw, n, nil
+}
+
+// setFlags sets the flags of h implied by the configuration and aad, along
+// with the version they require.
+func (s *Signer) setFlags(h *header, aad []aadPart) {
+	if aad != nil {
+		h.flags |= flagAAD
+	}
+	if s.SchemaVersion != 0 {
+		h.flags |= flagSchema
+		h.schema = s.SchemaVersion
+	}
+	if s.Audience != "" {
+		h.flags |= flagAudience
+		h.audience = audienceTag(s.Audience)
+	}
+	if s.Generation != 0 {
+		h.flags |= flagGeneration
+		h.generation = s.Generation
+	}
+	if s.Fingerprint {
+		h.flags |= flagFingerprint
+	}
+	if s.ContentType != 0 {
+		h.flags |= flagContentType
+		h.contentType = s.ContentType
+	}
+	if s.KeyID != 0 {
+		h.flags |= flagKeyID
+		h.keyID = s.KeyID
+	}
+	if s.Issuer != 0 {
+		h.flags |= flagIssuer
+		h.issuer = s.Issuer
+	}
+	if s.EmbedLength {
+		h.flags |= flagLength
 	}
 
-	var header [headerLen]byte
-	next := header[:]
+	h.version = version
+	if s.TrailingSig {
+		h.version = versionTrailing
+	} else if h.flags != 0 {
+		h.version = versionFlags
+	}
+}
 
-	next[0] = version
-	next = next[versionLen:]
+// token is a decoded token.
+type token struct {
+	header  header
+	sig     [sigLen]byte
+	payload []byte
 
-	issue := s.now()
-	binary.LittleEndian.PutUint64(next[:], uint64(issue.UnixNano()))
-	next = next[issueLen:]
+	// aad is the associated data the token must have been generated with.
+	// It is set before parsing.
+	aad []aadPart
 
-	s.salt(next[:saltLen])
-	next = next[saltLen:]
+	// now, if set before parsing, is the time the token is verified at.
+	now time.Time
 
-	s.sign(header[:sigOffset], payload, next[:0])
+	// ttl, if set before parsing, is the only TTL accepted, instead of the
+	// TTL and PreviousTTL of the Signer.
+	ttl time.Duration
 
-	payloadEncLen := base64.RawURLEncoding.EncodedLen(len(payload))
-	blob := make([]byte, payloadEncLen+encHeaderLen)
-	base64.RawURLEncoding.Encode(blob, header[:])
-	base64.RawURLEncoding.Encode(blob[encHeaderLen:], payload)
-	return blob
+	// lenOnly, if set before parsing, verifies the payload without keeping
+	// it. payloadLen is the length of the payload either way.
+	lenOnly    bool
+	payloadLen int
+
+	// cost is the number of HMACs computed over the token while parsing.
+	cost int
 }
 
 // Parse returns the original payload. It verifies the signature and
 // ensures the TTL is respected.
 func (s *Signer) Parse(b []byte) ([]byte, error) {
-	if len(b) < encHeaderLen {
-		return nil, ErrTooShort
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
 	}
+	return t.payload, nil
+}
+
+// ParseAt is like Parse, but verifies the token as of now instead of the
+// current time. It allows using a trusted clock, or auditing tokens at a past
+// instant.
+func (s *Signer) ParseAt(b []byte, now time.Time) ([]byte, error) {
+	t := token{now: now}
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return t.payload, nil
+}
 
-	var header [headerLen]byte
-	next := header[:]
-	_, err := base64.RawURLEncoding.Decode(next, b[:encHeaderLen])
+// verify parses b into t, and records the outcome.
+func (s *Signer) verify(b []byte, t *token) error {
+	if t.now.IsZero() {
+		t.now = time.Now()
+	}
+	err := s.parse(b, t)
+	s.record(err)
+	if err == nil && s.OnNearExpiry != nil {
+		expiry := s.expiresAt(&t.header, s.tokenTTL(t))
+		if remaining := expiry.Sub(t.now); remaining <= s.NearExpiry {
+			s.OnNearExpiry(remaining)
+		}
+	}
+	return err
+}
+
+func (s *Signer) parse(b []byte, t *token) error {
+	first := true
+	var last error
+	err := s.eachEncoding(b, func(enc Encoding, b []byte) error {
+		if first {
+			first = false
+			last = s.parseEncoding(enc, b, t)
+			return last
+		}
+		// A legacy attempt is kept only if eachEncoding keeps its error, so
+		// the token always describes the attempt behind the returned error.
+		scratch := *t
+		err := s.parseEncoding(enc, b, &scratch)
+		if err == nil || isDecodeErr(last) {
+			*t = scratch
+			last = err
+		} else {
+			t.cost = scratch.cost
+		}
+		return err
+	})
+	// Oversized input is rejected before any work, and is never burned.
+	if s.UniformTiming && err != nil && err != ErrTokenTooLong &&
+		kindOf(err) == KindMalformed {
+		s.burn(len(b))
+		t.cost++
+	}
+	return err
+}
+
+// eachEncoding calls fn with b prepared for decoding, first with the
+// Encoding and then with each of the LegacyEncodings until one succeeds. It
+// returns the most relevant error if none do.
+func (s *Signer) eachEncoding(b []byte, fn func(enc Encoding, b []byte) error) error {
+	if s.MaxTokenLen != 0 && len(b) > s.MaxTokenLen {
+		return ErrTokenTooLong
+	}
+	if s.Hints {
+		b = stripHint(b)
+	}
+	if s.TolerantDecode {
+		b = s.stripPadding(b)
+	}
+	err := fn(s.encoding(), b)
+	for _, enc := range s.LegacyEncodings {
+		if err == nil {
+			break
+		}
+		if legacyErr := fn(enc, b); legacyErr == nil || isDecodeErr(err) {
+			err = legacyErr
+		}
+	}
+	return err
+}
+
+func (s *Signer) parseEncoding(enc Encoding, b []byte, t *token) error {
+	h := &t.header
+	var raw [maxHeaderLen]byte
+	headerLen, b, err := s.decodeToken(enc, b, h, raw[:])
 	if err != nil {
-		return nil, ErrInvalidEncoding
+		return err
 	}
-	b = b[encHeaderLen:]
 
-	if next[0] != version {
-		return nil, ErrInvalidVersion
+	var payload []byte
+	if t.lenOnly {
+		var tried int
+		t.payloadLen, tried, err = s.checkSigChunks(h, raw[:headerLen], t.aad, enc, b, t.now)
+		t.cost += tried
+		if err != nil {
+			return err
+		}
+	} else {
+		if payload, err = decodePayload(enc, h, b); err != nil {
+			return err
+		}
+		tried, err := s.checkSig(h, raw[:headerLen], t.aad, payload, t.now)
+		t.cost += tried
+		if err != nil {
+			return err
+		}
+		t.payloadLen = len(payload)
+	}
+	if err := checkLength(h, t.payloadLen); err != nil {
+		return err
+	}
+	if err := s.checkClaims(h, t.now, s.tokenTTL(t)); err != nil {
+		return err
 	}
-	next = next[versionLen:]
+	copy(t.sig[:], raw[headerLen-sigLen:headerLen])
+	t.payload = payload
+	return nil
+}
 
-	ts := int64(binary.LittleEndian.Uint64(next[:issueLen]))
-	issue := time.Unix(0, ts)
-	if issue.Add(s.TTL).Before(time.Now()) {
-		return nil, ErrTimestampExpired
+// decodeToken decodes the header of b using enc into h and raw, which must
+// be at least maxHeaderLen bytes, without verifying it. It returns the
+// decoded length of the header including the signature, and the encoded
+// payload.
+func (s *Signer) decodeToken(enc Encoding, b []byte, h *header, raw []byte) (int, []byte, error) {
+	*h = header{}
+	encLen, headerLen, err := decodeHeader(enc, b, h, raw)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.checkVersion(h); err != nil {
+		return 0, nil, err
+	}
+	b = b[encLen:]
+	if s.Delimiter != 0 {
+		if len(b) == 0 || b[0] != s.Delimiter {
+			return 0, nil, ErrInvalidEncoding
+		}
+		b = b[1:]
 	}
-	next = next[issueLen:]
+	if err := checkTruncated(enc, h, b); err != nil {
+		return 0, nil, err
+	}
+	if h.version == versionTrailing {
+		if b, err = decodeTrailingSig(enc, b, raw[headerLen:]); err != nil {
+			return 0, nil, err
+		}
+		headerLen += sigLen
+	}
+	return headerLen, b, nil
+}
 
+// decodePayload decodes the encoded payload b of the token with the header h.
+func decodePayload(enc Encoding, h *header, b []byte) ([]byte, error) {
 	var payload []byte
-	if payloadLen := len(b); payloadLen > 0 {
-		payload = make([]byte, base64.RawURLEncoding.DecodedLen(payloadLen))
-		n, err := base64.RawURLEncoding.Decode(payload, b)
+	if len(b) > 0 {
+		payload = make([]byte, enc.DecodedLen(len(b)))
+		n, err := enc.Decode(payload, b)
 		if err != nil {
 			return nil, ErrInvalidEncoding
 		}
 		payload = payload[:n]
 	}
+	if h.flags&flagEmpty != 0 {
+		if len(payload) != 0 {
+			return nil, ErrInvalidEncoding
+		}
+		payload = []byte{}
+	}
+	return payload, nil
+}
+
+// checkVersion ensures the version of the header h is accepted.
+func (s *Signer) checkVersion(h *header) error {
+	if h.version == versionNoSalt && !s.LegacyNoSalt {
+		return ErrInvalidVersion
+	}
+	if h.version < s.MinVersion ||
+		(s.MaxVersion != 0 && h.version > s.MaxVersion) {
+		return ErrInvalidVersion
+	}
+	return nil
+}
+
+// checkClaims ensures the signed fields of the header h are acceptable at
+// now. It must only be called once the signature has been verified.
+func (s *Signer) checkClaims(h *header, now time.Time, ttl time.Duration) error {
+	if err := s.checkTime(h, now, ttl); err != nil {
+		return err
+	}
+	return s.checkScope(h, now, ttl)
+}
+
+// checkScope ensures the signed fields of the header h other than its times
+// are acceptable at now, for a token accepted for ttl.
+func (s *Signer) checkScope(h *header, now time.Time, ttl time.Duration) error {
+	var audience [audienceLen]byte
+	if s.Audience != "" {
+		audience = audienceTag(s.Audience)
+	}
+	if (h.flags&flagAudience != 0) != (s.Audience != "") ||
+		h.audience != audience {
+		return ErrWrongAudience
+	}
+	if h.generation < s.MinGeneration {
+		return ErrStaleGeneration
+	}
+	if s.AllowedIssuers != nil && bytes.IndexByte(s.AllowedIssuers, h.issuer) < 0 {
+		return ErrUnknownIssuer
+	}
+	if s.ExpectSalt != nil && !s.ExpectSalt(h.salt) {
+		return ErrUnexpectedSalt
+	}
+	if s.ReplayFilter != nil &&
+		s.ReplayFilter.seen(h, now, ttl+s.pastLeeway()) {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// audienceTag returns the truncated hash of the audience carried in the
+// header.
+func audienceTag(audience string) [audienceLen]byte {
+	var tag [audienceLen]byte
+	sum := sha256.Sum256([]byte("hmacsigner audience " + audience))
+	copy(tag[:], sum[:])
+	return tag
+}
+
+// checkTime ensures the token is valid at now, when accepted for ttl.
+func (s *Signer) checkTime(h *header, now time.Time, ttl time.Duration) error {
+	issue := s.time(h.issue)
+	if h.issue < 0 || issue.Before(s.EarliestValid) {
+		return ErrTimestampImplausible
+	}
+	if issue.Add(ttl + s.pastLeeway()).Before(now) {
+		return &ExpiredError{IssuedAt: issue, ExpiredAt: issue.Add(ttl)}
+	}
+	future := now.Add(s.futureLeeway())
+	if s.FutureLeeway != 0 && future.Before(issue) {
+		return ErrNotYetValid
+	}
+	start := issue
+	if h.flags&flagNotBefore != 0 {
+		notBefore := s.time(h.notBefore)
+		if future.Before(notBefore) {
+			return ErrNotYetValid
+		}
+		if notBefore.After(start) {
+			start = notBefore
+		}
+	}
+	if issue.Add(ttl).Sub(start) < s.MinAcceptedTTL {
+		return ErrTTLTooShort
+	}
+	return nil
+}
 
+// pastLeeway returns the clock skew tolerated past the expiry of a token.
+func (s *Signer) pastLeeway() time.Duration {
+	if s.PastLeeway != 0 {
+		return s.PastLeeway
+	}
+	return s.Leeway
+}
+
+// futureLeeway returns the clock skew tolerated before a token is valid.
+func (s *Signer) futureLeeway() time.Duration {
+	if s.FutureLeeway != 0 {
+		return s.FutureLeeway
+	}
+	return s.Leeway
+}
+
+// checkSig ensures the signature at the end of the decoded header h matches
+// using one of the keys accepted at now. It returns the number of keys tried.
+func (s *Signer) checkSig(
+	h *header,
+	raw []byte,
+	aad []aadPart,
+	payload []byte,
+	now time.Time,
+) (int, error) {
+	if (h.flags&flagAAD != 0) != (aad != nil) {
+		return 0, ErrSignatureMismatch
+	}
+	if err := s.checkFingerprint(h); err != nil {
+		return 0, err
+	}
+	secrets, err := s.secrets(h, now)
+	if err != nil {
+		return 0, err
+	}
+	signedLen := len(raw) - sigLen
 	var expectedSig [sha256.Size]byte
-	s.sign(header[:sigOffset], payload, expectedSig[:0])
-	if !hmac.Equal(expectedSig[:], header[sigOffset:]) {
-		return nil, ErrSignatureMismatch
+	for i, secret := range secrets {
+		sign(secret, raw[:signedLen], aad, payload, expectedSig[:0])
+		if hmac.Equal(expectedSig[:], raw[signedLen:]) {
+			return i + 1, nil
+		}
+	}
+	return len(secrets), ErrSignatureMismatch
+}
+
+// ParseWithCost is like Parse, and also returns the number of HMACs computed
+// over the token while verifying it. Configurations with several secrets,
+// key periods, legacy encodings or UniformTiming cost more, which allows
+// weighting requests when rate limiting.
+func (s *Signer) ParseWithCost(b []byte) ([]byte, int, error) {
+	var t token
+	err := s.verify(b, &t)
+	return t.payload, t.cost, err
+}
+
+// VerifyParts verifies an already decoded header and payload, ensuring the
+// signature matches and the TTL is respected.
+func (s *Signer) VerifyParts(header []byte, payload []byte) error {
+	err := s.verifyParts(header, payload)
+	s.record(err)
+	return err
+}
+
+func (s *Signer) verifyParts(raw []byte, payload []byte) error {
+	var h header
+	n, err := readHeader(raw, &h)
+	if err != nil {
+		return err
+	}
+	if n != len(raw) {
+		return ErrInvalidEncoding
+	}
+	if err := s.checkVersion(&h); err != nil {
+		return err
+	}
+	now := time.Now()
+	if _, err := s.checkSig(&h, raw, nil, payload, now); err != nil {
+		return err
+	}
+	if err := checkLength(&h, len(payload)); err != nil {
+		return err
+	}
+	return s.checkClaims(&h, now, s.acceptedTTL())
+}
+
+// AssembleToken lays out and encodes a version 1 token, or a version 0 one
+// without the salt, from parts computed elsewhere. It performs no signing
+// nor verification of any kind, and is meant as an escape hatch for custom
+// pipelines. The issue time is relative to the Unix epoch.
+func AssembleToken(
+	version byte,
+	issue time.Time,
+	salt [saltLen]byte,
+	sig, payload []byte,
+	enc *base64.Encoding,
+) []byte {
+	raw := make([]byte, 0, headerLen)
+	raw = append(raw, version)
+	var stamp [issueLen]byte
+	binary.LittleEndian.PutUint64(stamp[:], uint64(issue.UnixNano()))
+	raw = append(raw, stamp[:]...)
+	if version != versionNoSalt {
+		raw = append(raw, salt[:]...)
+	}
+	raw = append(raw, sig...)
+
+	n := enc.EncodedLen(len(raw))
+	out := make([]byte, n+enc.EncodedLen(len(payload)))
+	enc.Encode(out, raw)
+	enc.Encode(out[n:], payload)
+	return out
+}
+
+// ParseEncodedParts is like Parse, but for a token already split into its
+// encoded header and payload, without the Delimiter. It avoids joining them
+// back together. For tokens generated with TrailingSig, the payload is
+// followed by the signature.
+func (s *Signer) ParseEncodedParts(encHeader, encPayload string) ([]byte, error) {
+	payload, err := s.parseEncodedParts(encHeader, encPayload)
+	s.record(err)
+	return payload, err
+}
+
+func (s *Signer) parseEncodedParts(encHeader, encPayload string) ([]byte, error) {
+	if s.MaxTokenLen != 0 && len(encHeader)+len(encPayload) > s.MaxTokenLen {
+		return nil, ErrTokenTooLong
+	}
+	enc := s.encoding()
+	var h header
+	var raw [maxHeaderLen]byte
+	encLen, headerLen, err := decodeHeader(enc, []byte(encHeader), &h, raw[:])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTruncated(enc, &h, []byte(encPayload)); err != nil {
+		return nil, err
+	}
+	if h.version == versionTrailing {
+		// The signature follows the payload.
+		rest, err := decodeTrailingSig(enc, []byte(encPayload), raw[headerLen:])
+		if err != nil {
+			return nil, err
+		}
+		encPayload = encPayload[:len(rest)]
+		headerLen += sigLen
+	}
+	if encLen != len(encHeader) {
+		return nil, ErrInvalidEncoding
+	}
+	if err := s.checkVersion(&h); err != nil {
+		return nil, err
+	}
+
+	payload, err := decodePayload(enc, &h, []byte(encPayload))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if _, err := s.checkSig(&h, raw[:headerLen], nil, payload, now); err != nil {
+		return nil, err
+	}
+	if err := checkLength(&h, len(payload)); err != nil {
+		return nil, err
+	}
+	if err := s.checkClaims(&h, now, s.acceptedTTL()); err != nil {
+		return nil, err
 	}
 	return payload, nil
 }
+
+// ParseSchema verifies b like Parse, and returns the payload along with the
+// SchemaVersion it was generated with.
+func (s *Signer) ParseSchema(b []byte) ([]byte, byte, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, 0, err
+	}
+	return t.payload, t.header.schema, nil
+}
+
+// SignatureOf verifies b like Parse, and returns its signature.
+func (s *Signer) SignatureOf(b []byte) ([]byte, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return t.sig[:], nil
+}
+
+// LookupKey verifies b like Parse, and returns a key derived from it which
+// can be used to store server side state for the token. The same token always
+// returns the same key, and the token can't be recovered from the key.
+func (s *Signer) LookupKey(b []byte) (string, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte("hmacsigner lookup "))
+	h.Write(t.sig[:])
+	var sum [sha256.Size]byte
+	return base64.RawURLEncoding.EncodeToString(h.Sum(sum[:0])[:16]), nil
+}
+
+// TokenID verifies b like Parse, and returns a short hex ID for it which is
+// safe to log. It is an HMAC of the time of issue and salt of the token keyed
+// by the current secret, so it does not depend on the payload, is the same
+// for every copy of the token, and changes when the secret is rotated.
+func (s *Signer) TokenID(b []byte) (string, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return "", err
+	}
+	keys, err := s.keys(&t.header)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, keys[0])
+	mac.Write([]byte("hmacsigner token id "))
+	var issue [issueLen]byte
+	binary.LittleEndian.PutUint64(issue[:], uint64(t.header.issue))
+	mac.Write(issue[:])
+	mac.Write(t.header.salt[:])
+	var sum [sha256.Size]byte
+	return hex.EncodeToString(mac.Sum(sum[:0])[:8]), nil
+}
+
+// SamePayload verifies both tokens like Parse, and reports if they carry the
+// same payload regardless of when they were issued.
+func (s *Signer) SamePayload(a, b []byte) (bool, error) {
+	var ta, tb token
+	if err := s.verify(a, &ta); err != nil {
+		return false, err
+	}
+	if err := s.verify(b, &tb); err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(ta.payload, tb.payload) == 1, nil
+}
@@ -2,10 +2,16 @@ package hmacsigner
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -66,9 +72,9 @@ func TestErrors(t *testing.T) {
 			Err:  ErrInvalidVersion,
 		},
 		{
-			Name: "ts expired",
+			Name: "forged expired ts",
 			Data: []byte(validVersion + strings.Repeat("A", encHeaderLen)),
-			Err:  ErrTimestampExpired,
+			Err:  ErrSignatureMismatch,
 		},
 		{
 			Name: "invalid payload encoding",
@@ -148,3 +154,1170 @@ func BenchmarkParse(b *testing.B) {
 		}
 	}
 }
+
+func TestGenAt(t *testing.T) {
+	signer := Signer{
+		Secret:                bytes.Repeat([]byte("a"), 32),
+		TTL:                   time.Hour,
+		RejectClockRegression: true,
+	}
+	issue := time.Now().Add(-30 * time.Minute).Round(0)
+	gen := signer.GenAt([]byte("a@b.c"), issue)
+	claims, err := signer.ParseFull(gen)
+	ensure.Nil(t, err)
+	ensure.True(t, claims.IssuedAt.Equal(issue), claims.IssuedAt)
+	ensure.DeepEqual(t, claims.Payload, []byte("a@b.c"))
+
+	// Historical tokens expire a TTL after they were issued.
+	_, err = signer.Parse(signer.GenAt([]byte("a@b.c"), issue.Add(-time.Hour)))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	// Explicit issue times don't count towards RejectClockRegression.
+	signer.GenAt(nil, time.Now().Add(time.Hour))
+	_, err = signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+
+	defer ensure.PanicDeepEqual(t, shortSecretPanic)
+	(&Signer{Secret: []byte("short")}).GenAt(nil, issue)
+}
+
+func TestNotBefore(t *testing.T) {
+	givenPayload := []byte("a@b.c")
+	now := time.Now()
+	cases := []struct {
+		Name      string
+		Issue     time.Time
+		NotBefore time.Time
+		Err       error
+	}{
+		{
+			Name:      "before window",
+			Issue:     now,
+			NotBefore: now.Add(time.Minute),
+			Err:       ErrNotYetValid,
+		},
+		{
+			Name:      "within window",
+			Issue:     now.Add(-time.Minute),
+			NotBefore: now.Add(-time.Second),
+		},
+		{
+			Name:      "after window",
+			Issue:     now.Add(-2 * time.Hour),
+			NotBefore: now.Add(-90 * time.Minute),
+			Err:       ErrTimestampExpired,
+		},
+	}
+
+	for _, c := range cases {
+		issue := c.Issue
+		signer := Signer{
+			Secret: bytes.Repeat([]byte("a"), 32),
+			TTL:    time.Hour,
+			nowF:   func() time.Time { return issue },
+		}
+		gen := signer.GenNotBefore(givenPayload, c.NotBefore)
+		actual, err := signer.Parse(gen)
+		ensure.True(t, errors.Is(err, c.Err), c.Name, err)
+		if err == nil {
+			ensure.DeepEqual(t, actual, givenPayload, c.Name)
+		}
+	}
+}
+
+func TestNotBeforeTampered(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.GenNotBefore([]byte("a@b.c"), time.Now().Add(time.Hour))
+
+	var h header
+	var raw [maxHeaderLen]byte
+	encLen, headerLen, err := decodeHeader(base64.RawURLEncoding, gen, &h, raw[:])
+	ensure.Nil(t, err)
+	h.notBefore = time.Now().Add(-time.Hour).UnixNano()
+	h.marshal(raw[:])
+	tampered := base64.RawURLEncoding.EncodeToString(raw[:headerLen]) +
+		string(gen[encLen:])
+
+	_, err = signer.Parse([]byte(tampered))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestUnknownFlags(t *testing.T) {
+	data := base64.RawURLEncoding.EncodeToString(
+		append([]byte{versionFlags, 0, 0x80}, make([]byte, headerLen)...))
+	_, err := (&Signer{}).Parse([]byte(data))
+	ensure.DeepEqual(t, err, ErrInvalidVersion)
+}
+
+func TestUniformTiming(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	uniform := signer
+	uniform.UniformTiming = true
+
+	cases := [][]byte{
+		nil,
+		[]byte(strings.Repeat("$", encHeaderLen)),
+		[]byte(strings.Repeat("A", encHeaderLen)),
+		signer.GenNotBefore(nil, time.Now().Add(time.Hour)),
+		(&Signer{Secret: bytes.Repeat([]byte("b"), 32)}).Gen(nil),
+		signer.Gen([]byte("a@b.c")),
+	}
+	for _, c := range cases {
+		expectedPayload, expectedErr := signer.Parse(c)
+		actualPayload, actualErr := uniform.Parse(c)
+		ensure.DeepEqual(t, actualErr, expectedErr, string(c))
+		ensure.DeepEqual(t, actualPayload, expectedPayload, string(c))
+	}
+}
+
+// BenchmarkSignatureCompareTiming compares the time taken to reject
+// signatures that differ in their first or last byte with the time taken to
+// accept a matching one, both for the comparison alone and for Parse.
+//
+// Signatures are compared with hmac.Equal, which uses
+// subtle.ConstantTimeCompare and looks at every byte regardless of where the
+// first difference is. The three cases should report the same time within
+// noise, and a forger learns nothing about how many leading bytes of a guess
+// were correct. Parse additionally spends the same HMAC computation on all
+// three before comparing, and is only slower for the match because it then
+// checks the claims and copies the payload. Signatures are never truncated,
+// so there is no shorter comparison to cover.
+func BenchmarkSignatureCompareTiming(b *testing.B) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	payload := []byte("a@b.c")
+	raw, err := base64.RawURLEncoding.DecodeString(
+		string(signer.Gen(payload)[:encHeaderLen]))
+	if err != nil {
+		b.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		flip int
+	}{
+		{"Match", -1},
+		{"FirstByte", sigOffset},
+		{"LastByte", headerLen - 1},
+	}
+	for _, c := range cases {
+		header := append([]byte(nil), raw...)
+		if c.flip >= 0 {
+			header[c.flip] ^= 1
+		}
+		expected := raw[sigOffset:headerLen]
+		actual := header[sigOffset:headerLen]
+		b.Run("Equal/"+c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if hmac.Equal(expected, actual) != (c.flip < 0) {
+					b.Fatal("unexpected comparison result")
+				}
+			}
+		})
+		gen := []byte(base64.RawURLEncoding.EncodeToString(header) +
+			base64.RawURLEncoding.EncodeToString(payload))
+		b.Run("Parse/"+c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := signer.Parse(gen); (err == nil) != (c.flip < 0) {
+					b.Fatal("unexpected parse result", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseUniformTiming(b *testing.B) {
+	signer := Signer{
+		Secret:        bytes.Repeat([]byte("a"), 32),
+		TTL:           time.Hour,
+		UniformTiming: true,
+	}
+	valid := signer.Gen([]byte("a@b.c"))
+	garbage := bytes.Repeat([]byte("$"), len(valid))
+
+	b.Run("Valid", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := signer.Parse(valid); err != nil {
+				b.Fatal("parse error", err)
+			}
+		}
+	})
+	b.Run("Garbage", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := signer.Parse(garbage); err == nil {
+				b.Fatal("expected error")
+			}
+		}
+	})
+}
+
+func TestSignatureOf(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	sig, err := signer.SignatureOf(gen)
+	ensure.Nil(t, err)
+
+	var h header
+	var raw [maxHeaderLen]byte
+	_, headerLen, err := decodeHeader(base64.RawURLEncoding, gen, &h, raw[:])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, sig, raw[headerLen-sigLen:headerLen])
+
+	other := Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}
+	sig, err = other.SignatureOf(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.True(t, sig == nil)
+}
+
+func TestMaxTokenLen(t *testing.T) {
+	signer := Signer{
+		Secret:        bytes.Repeat([]byte("a"), 32),
+		TTL:           time.Hour,
+		MaxTokenLen:   100,
+		UniformTiming: true,
+	}
+	valid := signer.Gen([]byte("a@b.c"))
+	_, err := signer.Parse(valid)
+	ensure.Nil(t, err)
+
+	_, err = signer.Parse(signer.Gen(bytes.Repeat([]byte("a"), 100)))
+	ensure.DeepEqual(t, err, ErrTokenTooLong)
+
+	start := time.Now()
+	_, err = signer.Parse(bytes.Repeat([]byte("A"), 64<<20))
+	ensure.DeepEqual(t, err, ErrTokenTooLong)
+	ensure.True(t, time.Since(start) < time.Second)
+
+	// UniformTiming must not burn an HMAC over oversized input.
+	_, cost, err := signer.ParseWithCost(bytes.Repeat([]byte("A"), 1<<20))
+	ensure.DeepEqual(t, err, ErrTokenTooLong)
+	ensure.DeepEqual(t, cost, 0)
+}
+
+func TestVerifyParts(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	givenPayload := []byte("a@b.c")
+	gen := signer.Gen(givenPayload)
+	raw, err := base64.RawURLEncoding.DecodeString(string(gen[:encHeaderLen]))
+	ensure.Nil(t, err)
+	payload, err := base64.RawURLEncoding.DecodeString(string(gen[encHeaderLen:]))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, givenPayload)
+
+	ensure.Nil(t, signer.VerifyParts(raw, payload))
+	ensure.DeepEqual(t, signer.VerifyParts(raw, []byte("a@b.d")),
+		ErrSignatureMismatch)
+	ensure.DeepEqual(t, signer.VerifyParts(raw[:10], payload), ErrTooShort)
+	ensure.DeepEqual(t, signer.VerifyParts(append(raw, 0), payload),
+		ErrInvalidEncoding)
+
+	tampered := append([]byte(nil), raw...)
+	tampered[sigOffset-1] ^= 1
+	ensure.DeepEqual(t, signer.VerifyParts(tampered, payload),
+		ErrSignatureMismatch)
+
+	expired := Signer{Secret: signer.Secret}
+	err = expired.VerifyParts(raw, payload)
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+}
+
+func TestAssembleToken(t *testing.T) {
+	issue := time.Now().Add(-time.Minute)
+	salt := [saltLen]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+		saltF:  func(b []byte) { copy(b, salt[:]) },
+	}
+	for _, payload := range [][]byte{nil, []byte("a@b.c")} {
+		gen := signer.Gen(payload)
+		sig, err := signer.SignatureOf(gen)
+		ensure.Nil(t, err)
+		assembled := AssembleToken(version, issue, salt, sig, payload,
+			base64.RawURLEncoding)
+		ensure.DeepEqual(t, string(assembled), string(gen))
+	}
+
+	// Version 0 tokens have no salt.
+	var stamp [versionLen + issueLen]byte
+	binary.LittleEndian.PutUint64(stamp[versionLen:], uint64(issue.UnixNano()))
+	var sig [sigLen]byte
+	sign(signer.Secret, stamp[:], nil, []byte("a@b.c"), sig[:0])
+	legacy := signer
+	legacy.LegacyNoSalt = true
+	payload, err := legacy.Parse(AssembleToken(versionNoSalt, issue, salt, sig[:],
+		[]byte("a@b.c"), base64.RawURLEncoding))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	// The signature is not checked.
+	assembled := AssembleToken(version, issue, salt, make([]byte, sigLen),
+		nil, base64.RawURLEncoding)
+	_, err = signer.Parse(assembled)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestParseEncodedParts(t *testing.T) {
+	signer := Signer{
+		Secret:    bytes.Repeat([]byte("a"), 32),
+		TTL:       time.Hour,
+		Delimiter: '.',
+	}
+	split := func(gen []byte) (string, string) {
+		parts := strings.SplitN(string(gen), ".", 2)
+		return parts[0], parts[1]
+	}
+
+	encHeader, encPayload := split(signer.Gen([]byte("a@b.c")))
+	payload, err := signer.ParseEncodedParts(encHeader, encPayload)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	_, err = signer.ParseEncodedParts(encHeader, encPayload+"x")
+	ensure.NotNil(t, err)
+	_, err = signer.ParseEncodedParts(encHeader+"x", encPayload)
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+	_, err = signer.ParseEncodedParts(encHeader[:10], encPayload)
+	ensure.DeepEqual(t, err, ErrTooShort)
+	_, err = signer.ParseEncodedParts(encHeader, "")
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	encHeader, encPayload = split(signer.Gen([]byte{}))
+	ensure.DeepEqual(t, encPayload, "")
+	payload, err = signer.ParseEncodedParts(encHeader, encPayload)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte{})
+
+	encHeader, encPayload = split(signer.Gen(nil))
+	payload, err = signer.ParseEncodedParts(encHeader, encPayload)
+	ensure.Nil(t, err)
+	ensure.True(t, payload == nil)
+}
+
+func TestSecretLenBoundary(t *testing.T) {
+	cases := []struct {
+		Len   int
+		Panic bool
+		Warn  bool
+	}{
+		{Len: 31, Panic: true},
+		{Len: 32, Warn: true},
+		{Len: 63, Warn: true},
+		{Len: 64},
+	}
+	for _, c := range cases {
+		var warnings []string
+		signer := Signer{
+			Secret: bytes.Repeat([]byte("a"), c.Len),
+			TTL:    time.Hour,
+			Logf: func(format string, v ...interface{}) {
+				warnings = append(warnings, fmt.Sprintf(format, v...))
+			},
+		}
+		func() {
+			if c.Panic {
+				defer ensure.PanicDeepEqual(t, "secret less than 32 bytes", c.Len)
+			}
+			for i := 0; i < 2; i++ {
+				payload, err := signer.Parse(signer.Gen([]byte("a@b.c")))
+				ensure.Nil(t, err, c.Len)
+				ensure.DeepEqual(t, payload, []byte("a@b.c"), c.Len)
+			}
+		}()
+		if c.Warn {
+			ensure.DeepEqual(t, warnings, []string{fmt.Sprintf(
+				"hmacsigner: secret is %v bytes, at least 64 are recommended", c.Len)})
+		} else {
+			ensure.True(t, len(warnings) == 0, c.Len, warnings)
+		}
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	signer := &Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return time.Now().Add(-time.Minute) },
+	}
+	short := signer.WithTTL(time.Second)
+	ensure.DeepEqual(t, signer.TTL, time.Hour)
+	ensure.DeepEqual(t, short.TTL, time.Second)
+	ensure.True(t, &short.Secret[0] == &signer.Secret[0])
+
+	gen := signer.Gen([]byte("a@b.c"))
+	_, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	_, err = short.Parse(gen)
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+}
+
+func TestNearExpiry(t *testing.T) {
+	var calls []time.Duration
+	signer := Signer{
+		Secret:       bytes.Repeat([]byte("a"), 32),
+		TTL:          time.Hour,
+		NearExpiry:   5 * time.Minute,
+		OnNearExpiry: func(remaining time.Duration) { calls = append(calls, remaining) },
+	}
+	_, err := signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.True(t, len(calls) == 0, calls)
+
+	old := signer
+	old.nowF = func() time.Time { return time.Now().Add(-58 * time.Minute) }
+	_, err = signer.Parse(old.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(calls), 1)
+	ensure.True(t, calls[0] > time.Minute && calls[0] <= 2*time.Minute, calls)
+
+	expired := signer
+	expired.nowF = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	_, err = signer.Parse(expired.Gen([]byte("a@b.c")))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+	ensure.DeepEqual(t, len(calls), 1)
+}
+
+func TestSamePayload(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	a := signer.Gen([]byte("a@b.c"))
+	b := signer.Gen([]byte("a@b.c"))
+	ensure.NotDeepEqual(t, a, b)
+
+	same, err := signer.SamePayload(a, b)
+	ensure.Nil(t, err)
+	ensure.True(t, same)
+
+	same, err = signer.SamePayload(a, signer.Gen([]byte("b@b.c")))
+	ensure.Nil(t, err)
+	ensure.False(t, same)
+
+	same, err = signer.SamePayload(signer.Gen(nil), signer.Gen(nil))
+	ensure.Nil(t, err)
+	ensure.True(t, same)
+
+	forged := (&Signer{Secret: bytes.Repeat([]byte("b"), 32)}).Gen([]byte("a@b.c"))
+	same, err = signer.SamePayload(a, forged)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.False(t, same)
+	_, err = signer.SamePayload(forged, a)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestRejectClockRegression(t *testing.T) {
+	base := time.Now()
+	times := []time.Time{base, base.Add(time.Second), base.Add(time.Second), base}
+	signer := Signer{
+		Secret:                bytes.Repeat([]byte("a"), 32),
+		TTL:                   time.Hour,
+		RejectClockRegression: true,
+		nowF: func() time.Time {
+			now := times[0]
+			times = times[1:]
+			return now
+		},
+	}
+	for i := 0; i < 3; i++ {
+		_, err := signer.Parse(signer.Gen([]byte("a@b.c")))
+		ensure.Nil(t, err, i)
+	}
+	defer ensure.PanicDeepEqual(t, ErrClockWentBackwards)
+	signer.Gen([]byte("a@b.c"))
+}
+
+func TestClockRegressionAllowedByDefault(t *testing.T) {
+	times := []time.Time{time.Now(), time.Now().Add(-time.Second)}
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF: func() time.Time {
+			now := times[0]
+			times = times[1:]
+			return now
+		},
+	}
+	signer.Gen(nil)
+	signer.Gen(nil)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	signer := Signer{
+		Secret:        bytes.Repeat([]byte("a"), 32),
+		TTL:           time.Hour,
+		SchemaVersion: 3,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	payload, schema, err := signer.ParseSchema(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+	ensure.DeepEqual(t, schema, byte(3))
+
+	// Other signers accept it regardless of their own SchemaVersion.
+	payload, err = signer.WithTTL(time.Hour).Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	var h header
+	var raw [maxHeaderLen]byte
+	encLen, headerLen, err := decodeHeader(base64.RawURLEncoding, gen, &h, raw[:])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, h.schema, byte(3))
+	h.schema = 4
+	h.marshal(raw[:])
+	tampered := base64.RawURLEncoding.EncodeToString(raw[:headerLen]) +
+		string(gen[encLen:])
+	_, _, err = signer.ParseSchema([]byte(tampered))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	_, schema, err = signer.ParseSchema((&Signer{Secret: signer.Secret}).Gen(nil))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, schema, byte(0))
+}
+
+func TestAudience(t *testing.T) {
+	secret := bytes.Repeat([]byte("a"), 32)
+	a := Signer{Secret: secret, TTL: time.Hour, Audience: "a"}
+	b := Signer{Secret: secret, TTL: time.Hour, Audience: "b"}
+	none := Signer{Secret: secret, TTL: time.Hour}
+
+	gen := a.Gen([]byte("a@b.c"))
+	payload, err := a.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	_, err = b.Parse(gen)
+	ensure.DeepEqual(t, err, ErrWrongAudience)
+	_, err = none.Parse(gen)
+	ensure.DeepEqual(t, err, ErrWrongAudience)
+	_, err = a.Parse(none.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrWrongAudience)
+
+	// Forged tokens are reported as such, regardless of their audience.
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32), Audience: "b"}
+	_, err = a.Parse(forged.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestLeeway(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		Leeway: time.Minute,
+		nowF:   func() time.Time { return time.Now().Add(-time.Hour - 30*time.Second) },
+	}
+	_, err := signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	_, err = signer.WithTTL(time.Hour - time.Minute).Parse(signer.Gen(nil))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	signer.nowF = nil
+	_, err = signer.Parse(signer.GenNotBefore(nil, time.Now().Add(30*time.Second)))
+	ensure.Nil(t, err)
+	_, err = signer.Parse(signer.GenNotBefore(nil, time.Now().Add(2*time.Minute)))
+	ensure.DeepEqual(t, err, ErrNotYetValid)
+}
+
+func TestMinAcceptedTTL(t *testing.T) {
+	signer := Signer{
+		Secret:         bytes.Repeat([]byte("a"), 32),
+		TTL:            time.Hour,
+		MinAcceptedTTL: 10 * time.Minute,
+	}
+	ensure.Nil(t, signer.Validate())
+	now := time.Now()
+
+	// A valid signature, but usable for only a minute.
+	issuer := signer
+	issuer.nowF = func() time.Time { return now.Add(-59*time.Minute - 30*time.Second) }
+	gen := issuer.GenNotBefore([]byte("a@b.c"), now.Add(-30*time.Second))
+	_, err := signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrTTLTooShort)
+	ensure.DeepEqual(t, kindOf(err), KindRejected)
+
+	signer.MinAcceptedTTL = 0
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	signer.MinAcceptedTTL = 10 * time.Minute
+	payload, err = signer.Parse(signer.GenNotBefore([]byte("a@b.c"), now.Add(-time.Minute)))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	signer.MinAcceptedTTL = 2 * time.Hour
+	ensure.NotNil(t, signer.Validate())
+}
+
+func TestMinAcceptedTTLWithoutNotBefore(t *testing.T) {
+	signer := Signer{
+		Secret:         bytes.Repeat([]byte("a"), 32),
+		TTL:            time.Hour,
+		MinAcceptedTTL: time.Hour,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	// Tokens without a not before time are valid for the full TTL, which is
+	// measured against the longest accepted one.
+	signer.MinAcceptedTTL = 2 * time.Hour
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrTTLTooShort)
+	signer.PreviousTTL = 2 * time.Hour
+	_, err = signer.Parse(gen)
+	ensure.Nil(t, err)
+}
+
+func TestTimestampImplausible(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    100 * 365 * 24 * time.Hour,
+	}
+	ancient := Signer{
+		Secret: signer.Secret,
+		nowF:   func() time.Time { return time.Unix(-1, 0) },
+	}
+	_, err := signer.Parse(ancient.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrTimestampImplausible)
+	ensure.DeepEqual(t, kindOf(err), KindRejected)
+
+	old := ancient
+	old.nowF = func() time.Time { return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC) }
+	gen := old.Gen([]byte("a@b.c"))
+	_, err = signer.Parse(gen)
+	ensure.Nil(t, err)
+	signer.EarliestValid = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrTimestampImplausible)
+	_, err = signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+
+	// Before the Epoch.
+	epoch := Signer{
+		Secret: signer.Secret,
+		TTL:    time.Hour,
+		Epoch:  time.Now().Add(time.Minute),
+	}
+	_, err = epoch.Parse(epoch.Gen(nil))
+	ensure.DeepEqual(t, err, ErrTimestampImplausible)
+}
+
+func TestPreviousTTL(t *testing.T) {
+	old := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    2 * time.Hour,
+	}
+	issue := time.Now()
+	gen := old.Gen([]byte("a@b.c"))
+
+	shortened := old
+	shortened.TTL = time.Hour
+	_, err := shortened.ParseAt(gen, issue.Add(90*time.Minute))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	shortened.PreviousTTL = old.TTL
+	payload, err := shortened.ParseAt(gen, issue.Add(90*time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+	_, err = shortened.ParseAt(gen, issue.Add(121*time.Minute))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+	var expired *ExpiredError
+	ensure.True(t, errors.As(err, &expired))
+	ensure.True(t, expired.ExpiredAt.Equal(expired.IssuedAt.Add(old.TTL)))
+
+	// A PreviousTTL shorter than the TTL has no effect.
+	shortened.TTL, shortened.PreviousTTL = old.TTL, time.Minute
+	_, err = shortened.ParseAt(gen, issue.Add(90*time.Minute))
+	ensure.Nil(t, err)
+
+	ensure.DeepEqual(t, old.WithTTL(time.Hour).PreviousTTL, time.Duration(0))
+}
+
+func TestAsymmetricLeeway(t *testing.T) {
+	signer := Signer{
+		Secret:       bytes.Repeat([]byte("a"), 32),
+		TTL:          time.Hour,
+		Leeway:       time.Hour - 1,
+		PastLeeway:   10 * time.Minute,
+		FutureLeeway: time.Second,
+	}
+	issue := time.Now()
+	gen := signer.Gen([]byte("a@b.c"))
+
+	// Generous about verifiers with clocks ahead of the issuer.
+	_, err := signer.ParseAt(gen, issue.Add(time.Hour+9*time.Minute))
+	ensure.Nil(t, err)
+	_, err = signer.ParseAt(gen, issue.Add(time.Hour+11*time.Minute))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	// Strict about issuers with clocks ahead of the verifier.
+	_, err = signer.ParseAt(gen, issue.Add(-500*time.Millisecond))
+	ensure.Nil(t, err)
+	_, err = signer.ParseAt(gen, issue.Add(-2*time.Second))
+	ensure.DeepEqual(t, err, ErrNotYetValid)
+	notBefore := signer.GenNotBefore(nil, time.Now().Add(time.Minute))
+	_, err = signer.Parse(notBefore)
+	ensure.DeepEqual(t, err, ErrNotYetValid)
+	_, err = signer.ParseAt(notBefore, time.Now().Add(time.Minute-time.Millisecond*500))
+	ensure.Nil(t, err)
+
+	// Without a FutureLeeway, the Leeway applies and issue times in the future
+	// are accepted as before.
+	signer.FutureLeeway = 0
+	_, err = signer.ParseAt(gen, issue.Add(-2*time.Hour))
+	ensure.Nil(t, err)
+	_, err = signer.Parse(notBefore)
+	ensure.Nil(t, err)
+}
+
+func TestParseAt(t *testing.T) {
+	issue := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+
+	_, err := signer.Parse(gen)
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+	payload, err := signer.ParseAt(gen, issue.Add(time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+	_, err = signer.ParseAt(gen, issue.Add(time.Hour+time.Second))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	nb := signer.GenNotBefore(nil, issue.Add(time.Minute))
+	_, err = signer.ParseAt(nb, issue)
+	ensure.DeepEqual(t, err, ErrNotYetValid)
+	_, err = signer.ParseAt(nb, issue.Add(time.Minute))
+	ensure.Nil(t, err)
+
+	var remaining time.Duration
+	signer.OnNearExpiry = func(r time.Duration) { remaining = r }
+	signer.NearExpiry = time.Hour
+	_, err = signer.ParseAt(gen, issue.Add(40*time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, remaining, 20*time.Minute)
+}
+
+func TestGeneration(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	none := signer.Gen([]byte("none"))
+	signer.Generation = 1
+	first := signer.Gen([]byte("first"))
+	signer.Generation = 2
+	second := signer.Gen([]byte("second"))
+
+	for _, gen := range [][]byte{none, first, second} {
+		_, err := signer.Parse(gen)
+		ensure.Nil(t, err)
+	}
+
+	signer.MinGeneration = 2
+	_, err := signer.Parse(none)
+	ensure.DeepEqual(t, err, ErrStaleGeneration)
+	_, err = signer.Parse(first)
+	ensure.DeepEqual(t, err, ErrStaleGeneration)
+	payload, err := signer.Parse(second)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "second")
+
+	// The generation is signed.
+	forged := signer.Gen([]byte("second"))
+	decoded := make([]byte, len(forged))
+	n, err := base64.RawURLEncoding.Decode(decoded, forged[:signer.Overhead()])
+	ensure.Nil(t, err)
+	decoded[n-sigLen-1] = 3
+	forged = []byte(base64.RawURLEncoding.EncodeToString(decoded[:n]) +
+		string(forged[signer.Overhead():]))
+	_, err = signer.Parse(forged)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestAppendGen(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	prefix := []byte("token=")
+	for _, dst := range [][]byte{prefix, append(make([]byte, 0, 200), prefix...)} {
+		out := signer.AppendGenString(dst, []byte("a@b.c"))
+		ensure.DeepEqual(t, string(out[:len(prefix)]), "token=")
+		ensure.DeepEqual(t, len(out), len(prefix)+signer.EncodedLen(5))
+		payload, err := signer.Parse(out[len(prefix):])
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(payload), "a@b.c")
+	}
+	ensure.DeepEqual(t, string(prefix), "token=")
+
+	buf := make([]byte, 0, 200)
+	out := signer.AppendGen(buf, nil)
+	ensure.True(t, &out[0] == &buf[:1][0])
+	payload, err := signer.Parse(out)
+	ensure.Nil(t, err)
+	ensure.True(t, payload == nil)
+}
+
+func BenchmarkGenString(b *testing.B) {
+	givenPayload := []byte("a@b.c")
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	b.ReportAllocs()
+	buf := make([]byte, 0, 128)
+	for i := 0; i < b.N; i++ {
+		buf = append(buf[:0], "token="...)
+		buf = append(buf, string(signer.Gen(givenPayload))...)
+	}
+}
+
+func BenchmarkAppendGenString(b *testing.B) {
+	givenPayload := []byte("a@b.c")
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	b.ReportAllocs()
+	buf := make([]byte, 0, 128)
+	for i := 0; i < b.N; i++ {
+		buf = append(buf[:0], "token="...)
+		buf = signer.AppendGenString(buf, givenPayload)
+	}
+}
+
+func TestEpoch(t *testing.T) {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue := epoch.Add(24 * time.Hour)
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		Epoch:  epoch,
+		nowF:   func() time.Time { return issue },
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+
+	raw, err := base64.RawURLEncoding.DecodeString(string(gen[:signer.Overhead()]))
+	ensure.Nil(t, err)
+	var h header
+	_, err = readHeader(raw, &h)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, h.issue, int64(24*time.Hour))
+
+	payload, err := signer.ParseAt(gen, issue.Add(59*time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+	_, err = signer.ParseAt(gen, issue.Add(61*time.Minute))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	nb := signer.GenNotBefore(nil, issue.Add(time.Minute))
+	_, err = signer.ParseAt(nb, issue)
+	ensure.DeepEqual(t, err, ErrNotYetValid)
+	_, err = signer.ParseAt(nb, issue.Add(2*time.Minute))
+	ensure.Nil(t, err)
+
+	// Without the epoch the token appears to be from 1970.
+	signer.Epoch = time.Time{}
+	_, err = signer.ParseAt(gen, issue.Add(time.Minute))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+}
+
+func TestDelimiter(t *testing.T) {
+	signer := Signer{
+		Secret:    bytes.Repeat([]byte("a"), 32),
+		TTL:       time.Hour,
+		Delimiter: '.',
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	ensure.DeepEqual(t, len(gen), signer.EncodedLen(5))
+	ensure.DeepEqual(t, gen[signer.Overhead()-1], byte('.'))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	empty := signer.Gen(nil)
+	ensure.DeepEqual(t, len(empty), signer.Overhead())
+	payload, err = signer.Parse(empty)
+	ensure.Nil(t, err)
+	ensure.True(t, payload == nil)
+
+	undelimited := signer
+	undelimited.Delimiter = 0
+	_, err = signer.Parse(undelimited.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+	_, err = signer.Parse(undelimited.Gen(nil))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+	_, err = undelimited.Parse(gen)
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+
+	header := signer.GenDetached([]byte("a@b.c"))
+	ensure.Nil(t, signer.VerifyDetachedReader(header,
+		bytes.NewReader([]byte("a@b.c"))))
+}
+
+func TestDottedTokens(t *testing.T) {
+	signer := Signer{
+		Secret:    bytes.Repeat([]byte("a"), 32),
+		TTL:       time.Hour,
+		Delimiter: '.',
+	}
+	gen := signer.Gen([]byte(`{"sub":"a@b.c"}`))
+	parts := strings.Split(string(gen), ".")
+	ensure.DeepEqual(t, len(parts), 2)
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(raw), headerLen)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), `{"sub":"a@b.c"}`)
+	payload, err = signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), `{"sub":"a@b.c"}`)
+
+	// The default remains a single part.
+	signer.Delimiter = 0
+	gen = signer.Gen([]byte(`{"sub":"a@b.c"}`))
+	ensure.False(t, bytes.ContainsRune(gen, '.'))
+	ensure.DeepEqual(t, len(gen), signer.EncodedLen(15))
+}
+
+func TestLegacyNoSalt(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+
+	// Synthesize a token in the pre salt layout.
+	payload := []byte("a@b.c")
+	raw := make([]byte, versionLen+issueLen, noSaltHeaderLen)
+	raw[0] = versionNoSalt
+	binary.LittleEndian.PutUint64(raw[versionLen:], uint64(time.Now().UnixNano()))
+	mac := hmac.New(sha256.New, signer.Secret)
+	mac.Write(raw)
+	mac.Write(payload)
+	raw = mac.Sum(raw)
+	legacy := []byte(base64.RawURLEncoding.EncodeToString(raw) +
+		base64.RawURLEncoding.EncodeToString(payload))
+
+	_, err := signer.Parse(legacy)
+	ensure.DeepEqual(t, err, ErrInvalidVersion)
+
+	signer.LegacyNoSalt = true
+	actual, err := signer.Parse(legacy)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(actual), "a@b.c")
+
+	// The header remains signed.
+	raw[versionLen] ^= 1
+	tampered := []byte(base64.RawURLEncoding.EncodeToString(raw) +
+		base64.RawURLEncoding.EncodeToString(payload))
+	_, err = signer.Parse(tampered)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	// New tokens still include and require the salt.
+	gen := signer.Gen(payload)
+	ensure.DeepEqual(t, len(gen), signer.EncodedLen(len(payload)))
+	actual, err = signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(actual), "a@b.c")
+	decoded, err := base64.RawURLEncoding.DecodeString(string(gen[:signer.Overhead()]))
+	ensure.Nil(t, err)
+	decoded[0] = versionNoSalt
+	stripped := []byte(base64.RawURLEncoding.EncodeToString(decoded) +
+		string(gen[signer.Overhead():]))
+	_, err = signer.Parse(stripped)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestGuaranteedUniqueSalt(t *testing.T) {
+	signer := Signer{
+		Secret:               bytes.Repeat([]byte("a"), 32),
+		TTL:                  time.Hour,
+		GuaranteedUniqueSalt: true,
+		// A coarse clock and a broken random source.
+		nowF:  func() time.Time { return time.Unix(1600000000, 0) },
+		saltF: func(b []byte) { copy(b, "saltsalt") },
+	}
+	const workers, perWorker = 8, 1000
+	gens := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				gens <- string(signer.Gen([]byte("a@b.c")))
+			}
+		}()
+	}
+	wg.Wait()
+	close(gens)
+	seen := make(map[string]bool)
+	for gen := range gens {
+		ensure.False(t, seen[gen])
+		seen[gen] = true
+	}
+	ensure.DeepEqual(t, len(seen), workers*perWorker)
+
+	payload, err := signer.ParseAt(signer.Gen([]byte("a@b.c")),
+		time.Unix(1600000000, 0))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+}
+
+func TestExpiredError(t *testing.T) {
+	issue := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+	}
+	_, err := signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired))
+	var expired *ExpiredError
+	ensure.True(t, errors.As(err, &expired))
+	ensure.True(t, expired.IssuedAt.Equal(issue), expired.IssuedAt)
+	ensure.True(t, expired.ExpiredAt.Equal(issue.Add(time.Hour)), expired.ExpiredAt)
+	ensure.DeepEqual(t, err.Error(),
+		"hmacsigner: timestamp expired at 2020-01-01T01:00:00Z")
+
+	// Forged tokens do not reveal their claimed times.
+	forged := Signer{
+		Secret: bytes.Repeat([]byte("b"), 32),
+		TTL:    time.Hour,
+		nowF:   signer.nowF,
+	}
+	_, err = signer.Parse(forged.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.False(t, errors.As(err, &expired))
+}
+
+func TestVersionRange(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	v1 := signer.Gen([]byte("v1"))
+	v2 := signer.GenNotBefore([]byte("v2"), time.Now().Add(-time.Minute))
+	signer.Generation = 1
+	v2gen := signer.Gen([]byte("v2"))
+	signer.Generation = 0
+
+	cases := []struct {
+		Min, Max byte
+		V1, V2   error
+	}{
+		{},
+		{Min: 1, Max: 2},
+		{Min: 2, V1: ErrInvalidVersion},
+		{Max: 1, V2: ErrInvalidVersion},
+		{Min: 1, Max: 1, V2: ErrInvalidVersion},
+		{Min: 2, Max: 2, V1: ErrInvalidVersion},
+	}
+	for _, c := range cases {
+		signer.MinVersion, signer.MaxVersion = c.Min, c.Max
+		_, err := signer.Parse(v1)
+		ensure.DeepEqual(t, err, c.V1, c)
+		_, err = signer.Parse(v2)
+		ensure.DeepEqual(t, err, c.V2, c)
+		_, err = signer.Parse(v2gen)
+		ensure.DeepEqual(t, err, c.V2, c)
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	a := signer.Gen([]byte("a@b.c"))
+	b := signer.Gen([]byte("a@b.c"))
+
+	keyA, err := signer.LookupKey(a)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(keyA), 22)
+	again, err := signer.LookupKey(a)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, again, keyA)
+	keyB, err := signer.LookupKey(b)
+	ensure.Nil(t, err)
+	ensure.NotDeepEqual(t, keyB, keyA)
+	ensure.False(t, strings.Contains(string(a), keyA))
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	_, err = signer.LookupKey(forged.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestTokenID(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	payload := []byte("a@b.c")
+	a := signer.Gen(payload)
+	b := signer.Gen(payload)
+
+	idA, err := signer.TokenID(a)
+	ensure.Nil(t, err)
+	ensure.True(t, regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(idA), idA)
+	again, err := signer.TokenID(a)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, again, idA)
+	idB, err := signer.TokenID(b)
+	ensure.Nil(t, err)
+	ensure.NotDeepEqual(t, idB, idA)
+	ensure.False(t, strings.Contains(idA, hex.EncodeToString(payload)))
+
+	lookup, err := signer.LookupKey(a)
+	ensure.Nil(t, err)
+	ensure.NotDeepEqual(t, idA, lookup)
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	_, err = signer.TokenID(forged.Gen(payload))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestEmptyPayload(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	payload, err := signer.Parse(signer.Gen(nil))
+	ensure.Nil(t, err)
+	ensure.True(t, payload == nil)
+
+	payload, err = signer.Parse(signer.Gen([]byte{}))
+	ensure.Nil(t, err)
+	ensure.True(t, payload != nil)
+	ensure.DeepEqual(t, len(payload), 0)
+
+	payload, err = signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	payload, err = signer.ParseAAD(signer.GenAAD([]byte{}, nil), nil)
+	ensure.Nil(t, err)
+	ensure.True(t, payload != nil)
+}
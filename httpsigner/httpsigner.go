@@ -0,0 +1,84 @@
+// Package httpsigner provides net/http integration for hmacsigner.
+package httpsigner
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daaku/hmacsigner"
+)
+
+type contextKey struct{}
+
+// PayloadKey is the context key Middleware stores the verified payload under.
+var PayloadKey = contextKey{}
+
+// Payload returns the verified payload stored in ctx by Middleware.
+func Payload(ctx context.Context) ([]byte, bool) {
+	payload, ok := ctx.Value(PayloadKey).([]byte)
+	return payload, ok
+}
+
+// token returns the token in the named header, falling back to a bearer
+// token in the Authorization header.
+func token(r *http.Request, headerName string) string {
+	if headerName != "" {
+		if v := r.Header.Get(headerName); v != "" {
+			return v
+		}
+	}
+	const bearer = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(bearer) && strings.EqualFold(auth[:len(bearer)], bearer) {
+		return auth[len(bearer):]
+	}
+	return ""
+}
+
+// Middleware verifies the token in the named header, or the Authorization
+// bearer token, and calls next with the payload stored in the request
+// context. Requests without a valid token get a 401 response.
+func Middleware(s *hmacsigner.Signer, headerName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := token(r, headerName)
+		if t == "" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		payload, err := s.Parse([]byte(t))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), PayloadKey, payload)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Cookie returns a cookie whose value is a token for the payload, bound to
+// the cookie name as associated data. It expires with the token, and defaults
+// to HttpOnly, Secure and SameSite=Lax for the whole site. The attributes can
+// be changed before passing it to http.SetCookie.
+func Cookie(s *hmacsigner.Signer, name string, payload []byte) *http.Cookie {
+	gen := s.GenAAD(payload, []byte(name))
+	if gen == nil {
+		return nil
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    string(gen),
+		Path:     "/",
+		MaxAge:   int(s.TTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// FromCookie verifies the value of a cookie created by Cookie, and returns
+// the payload.
+func FromCookie(s *hmacsigner.Signer, c *http.Cookie) ([]byte, error) {
+	return s.ParseAAD([]byte(c.Value), []byte(c.Name))
+}
@@ -0,0 +1,103 @@
+package httpsigner
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+	"github.com/daaku/hmacsigner"
+)
+
+func newSigner() *hmacsigner.Signer {
+	return &hmacsigner.Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	signer := newSigner()
+	handler := Middleware(signer, "X-Token", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			payload, ok := Payload(r.Context())
+			ensure.True(t, ok)
+			w.Write(payload)
+		}))
+	token := string(signer.Gen([]byte("a@b.c")))
+	forged := (&hmacsigner.Signer{Secret: bytes.Repeat([]byte("b"), 32)}).
+		Gen([]byte("a@b.c"))
+
+	cases := []struct {
+		Name   string
+		Header http.Header
+		Code   int
+		Body   string
+	}{
+		{
+			Name:   "named header",
+			Header: http.Header{"X-Token": {token}},
+			Code:   http.StatusOK,
+			Body:   "a@b.c",
+		},
+		{
+			Name:   "bearer",
+			Header: http.Header{"Authorization": {"Bearer " + token}},
+			Code:   http.StatusOK,
+			Body:   "a@b.c",
+		},
+		{
+			Name:   "missing",
+			Header: http.Header{"Authorization": {"Basic " + token}},
+			Code:   http.StatusUnauthorized,
+			Body:   "missing token\n",
+		},
+		{
+			Name:   "invalid",
+			Header: http.Header{"X-Token": {string(forged)}},
+			Code:   http.StatusUnauthorized,
+			Body:   "invalid token\n",
+		},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header = c.Header
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		ensure.DeepEqual(t, w.Code, c.Code, c.Name)
+		ensure.DeepEqual(t, w.Body.String(), c.Body, c.Name)
+	}
+}
+
+func TestPayloadMissing(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	_, ok := Payload(r.Context())
+	ensure.False(t, ok)
+}
+
+func TestCookie(t *testing.T) {
+	signer := newSigner()
+	c := Cookie(signer, "session", []byte("a@b.c"))
+	ensure.DeepEqual(t, c.Name, "session")
+	ensure.DeepEqual(t, c.MaxAge, 3600)
+	ensure.True(t, c.HttpOnly)
+	ensure.True(t, c.Secure)
+	ensure.DeepEqual(t, c.SameSite, http.SameSiteLaxMode)
+
+	// Round trip through the headers.
+	w := httptest.NewRecorder()
+	http.SetCookie(w, c)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	received, err := r.Cookie("session")
+	ensure.Nil(t, err)
+	payload, err := FromCookie(signer, received)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	received.Name = "other"
+	_, err = FromCookie(signer, received)
+	ensure.DeepEqual(t, err, hmacsigner.ErrSignatureMismatch)
+}
@@ -0,0 +1,125 @@
+package hmacsigner
+
+import (
+	"errors"
+	"io"
+)
+
+// errDetachedLength is returned by GenDetachedReader with EmbedLength, since
+// the header is signed before the payload is read.
+var errDetachedLength = errors.New(
+	"hmacsigner: embedded length requires the payload up front")
+
+// checkLength ensures a length embedded in the header h matches the length
+// of the payload.
+func checkLength(h *header, payloadLen int) error {
+	if h.flags&flagLength != 0 && int64(h.length) != int64(payloadLen) {
+		return ErrInvalidEncoding
+	}
+	return nil
+}
+
+// checkTruncated reports ErrTruncated if the encoded payload b, followed by
+// the signature for version 3 tokens, is shorter than the length embedded in
+// the header h.
+func checkTruncated(enc Encoding, h *header, b []byte) error {
+	if h.flags&flagLength == 0 {
+		return nil
+	}
+	// Encoding never shrinks, and comparing first keeps int(h.length) from
+	// going negative where int is 32 bits.
+	if uint64(h.length) > uint64(len(b)) {
+		return ErrTruncated
+	}
+	n := enc.EncodedLen(int(h.length))
+	if h.version == versionTrailing {
+		n += enc.EncodedLen(sigLen)
+	}
+	if len(b) < n {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// ParseReader reads a single token generated with EmbedLength from r, and
+// verifies it like Parse. It reads exactly the bytes of the token, so tokens
+// can be read back to back without any framing. Tokens without an embedded
+// length are rejected with ErrInvalidEncoding, and those claiming to be
+// longer than MaxTokenLen, or 64KiB if it is not set, with ErrTokenTooLong.
+// The reader is not usable after an error. It returns io.EOF if r is empty.
+func (s *Signer) ParseReader(r io.Reader) ([]byte, error) {
+	b, err := s.readToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Parse(b)
+}
+
+// readToken reads the bytes of a single token with an embedded length,
+// without verifying it.
+func (s *Signer) readToken(r io.Reader) ([]byte, error) {
+	enc := s.encoding()
+	b := make([]byte, enc.EncodedLen(prefixLen))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	var h header
+	var raw [maxHeaderLen]byte
+	if _, err := enc.Decode(raw[:], b); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	var err error
+	if h.version, h.flags, err = readPrefix(raw[:]); err != nil {
+		return nil, err
+	}
+	if h.flags&flagLength == 0 {
+		return nil, ErrInvalidEncoding
+	}
+
+	headerLen, trailerLen := h.signedLen()+sigLen, 0
+	if h.version == versionTrailing {
+		headerLen, trailerLen = h.signedLen(), sigLen
+	}
+	b, err = readMore(r, b, enc.EncodedLen(headerLen))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := enc.Decode(raw[:], b); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	h.unmarshal(raw[:])
+	maxLen := s.MaxTokenLen
+	if maxLen == 0 {
+		maxLen = defaultMaxLineLen
+	}
+	// As in checkTruncated, compared before int(h.length) can overflow.
+	if uint64(h.length) > uint64(maxLen) {
+		return nil, ErrTokenTooLong
+	}
+	n := len(b) + enc.EncodedLen(int(h.length)) + enc.EncodedLen(trailerLen)
+	if s.Delimiter != 0 {
+		n++
+	}
+	if n > maxLen {
+		return nil, ErrTokenTooLong
+	}
+	return readMore(r, b, n)
+}
+
+// readMore reads from r until b is n bytes long.
+func readMore(r io.Reader, b []byte, n int) ([]byte, error) {
+	start := len(b)
+	if cap(b) < n {
+		grown := make([]byte, start, n)
+		copy(grown, b)
+		b = grown
+	}
+	b = b[:n]
+	if _, err := io.ReadFull(r, b[start:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,127 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestParseReader(t *testing.T) {
+	cases := []Signer{
+		{},
+		{Delimiter: '.'},
+		{Encoding: Base32Encoding},
+	}
+	payloads := [][]byte{
+		[]byte("a@b.c"),
+		nil,
+		{},
+		bytes.Repeat([]byte("x"), 1000),
+	}
+	for _, signer := range cases {
+		signer.Secret = bytes.Repeat([]byte("a"), 32)
+		signer.TTL = time.Hour
+		signer.EmbedLength = true
+
+		var stream bytes.Buffer
+		for _, payload := range payloads {
+			gen := signer.Gen(payload)
+			if len(payload) != 0 {
+				ensure.DeepEqual(t, len(gen), signer.EncodedLen(len(payload)))
+			}
+			stream.Write(gen)
+		}
+		for _, payload := range payloads {
+			parsed, err := signer.ParseReader(&stream)
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, parsed, payload)
+		}
+		_, err := signer.ParseReader(&stream)
+		ensure.DeepEqual(t, err, io.EOF)
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	plain := signer.Gen([]byte("a@b.c"))
+	_, err := signer.ParseReader(bytes.NewReader(plain))
+	ensure.DeepEqual(t, err, ErrInvalidEncoding)
+
+	signer.EmbedLength = true
+	gen := signer.Gen([]byte("a@b.c"))
+	_, err = signer.ParseReader(bytes.NewReader(gen[:len(gen)-1]))
+	ensure.DeepEqual(t, err, io.ErrUnexpectedEOF)
+	_, err = signer.ParseReader(bytes.NewReader(gen[:10]))
+	ensure.DeepEqual(t, err, io.ErrUnexpectedEOF)
+
+	signer.MaxTokenLen = 100
+	_, err = signer.ParseReader(bytes.NewReader(
+		signer.Gen(bytes.Repeat([]byte("x"), 100))))
+	ensure.DeepEqual(t, err, ErrTokenTooLong)
+
+	_, err = signer.GenDetachedReader(bytes.NewReader(nil))
+	ensure.NotNil(t, err)
+}
+
+func TestLengthMismatch(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		EmbedLength: true,
+	}
+	detached := signer.GenDetached([]byte("a@b.c"))
+	ensure.Nil(t, signer.VerifyDetachedReader(detached,
+		bytes.NewReader([]byte("a@b.c"))))
+
+	h := header{flags: flagLength, length: 5}
+	ensure.Nil(t, checkLength(&h, 5))
+	ensure.DeepEqual(t, checkLength(&h, 4), ErrInvalidEncoding)
+	ensure.Nil(t, checkLength(&header{}, 4))
+}
+
+func TestTruncated(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		EmbedLength: true,
+	}
+	payload := bytes.Repeat([]byte("x"), 100)
+	for _, trailing := range []bool{false, true} {
+		signer.TrailingSig = trailing
+		gen := signer.Gen(payload)
+		for _, cut := range []int{1, 10, len(gen) - signer.Overhead()} {
+			_, err := signer.Parse(gen[:len(gen)-cut])
+			ensure.DeepEqual(t, err, ErrTruncated, cut)
+			ensure.DeepEqual(t, kindOf(err), KindMalformed)
+		}
+		_, err := signer.Parse(gen[:20])
+		ensure.DeepEqual(t, err, ErrTooShort)
+	}
+
+	// Without the length truncation is indistinguishable from tampering.
+	signer.EmbedLength = false
+	signer.TrailingSig = false
+	gen := signer.Gen(payload)
+	_, err := signer.Parse(gen[:len(gen)-10])
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestLengthOverflow(t *testing.T) {
+	h := header{version: versionFlags, flags: flagLength, length: 0xffffffff}
+	ensure.DeepEqual(t, checkTruncated(base64.RawURLEncoding, &h, nil),
+		ErrTruncated)
+
+	raw := make([]byte, h.signedLen()+sigLen)
+	h.marshal(raw)
+	signer := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	_, err := signer.ParseReader(bytes.NewReader(
+		[]byte(base64.RawURLEncoding.EncodeToString(raw))))
+	ensure.DeepEqual(t, err, ErrTokenTooLong)
+}
@@ -0,0 +1,75 @@
+package hmacsigner
+
+import "errors"
+
+// ErrorKind classifies the outcome of Parse.
+type ErrorKind int
+
+const (
+	// KindSuccess is a token that was successfully verified.
+	KindSuccess ErrorKind = iota
+
+	// KindMalformed is a token that could not be decoded.
+	KindMalformed
+
+	// KindExpired is a token whose TTL has passed.
+	KindExpired
+
+	// KindNotYetValid is a token whose not before time is in the future.
+	KindNotYetValid
+
+	// KindMismatch is a token whose signature did not match.
+	KindMismatch
+
+	// KindRejected is an authentic token rejected by the configuration, such
+	// as one for a different Audience.
+	KindRejected
+)
+
+var kindNames = [...]string{
+	KindSuccess:     "success",
+	KindMalformed:   "malformed",
+	KindExpired:     "expired",
+	KindNotYetValid: "not_yet_valid",
+	KindMismatch:    "mismatch",
+	KindRejected:    "rejected",
+}
+
+// String returns a name suitable for use as a metric label.
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// Metrics receives the outcome of every Parse.
+type Metrics interface {
+	Inc(kind ErrorKind)
+}
+
+// kindOf returns the ErrorKind for an error returned by Parse.
+func kindOf(err error) ErrorKind {
+	if errors.Is(err, ErrTimestampExpired) {
+		return KindExpired
+	}
+	switch err {
+	case nil:
+		return KindSuccess
+	case ErrNotYetValid:
+		return KindNotYetValid
+	case ErrSignatureMismatch, ErrWrongSecret:
+		return KindMismatch
+	case ErrWrongAudience, ErrStaleGeneration, ErrUnexpectedSalt,
+		ErrTimestampImplausible, ErrTTLTooShort, ErrReplayed,
+		ErrUnknownIssuer:
+		return KindRejected
+	}
+	return KindMalformed
+}
+
+func (s *Signer) record(err error) {
+	if s.Metrics != nil {
+		s.Metrics.Inc(kindOf(err))
+	}
+}
@@ -0,0 +1,60 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+type countingMetrics map[ErrorKind]int
+
+func (m countingMetrics) Inc(kind ErrorKind) {
+	m[kind]++
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := countingMetrics{}
+	signer := Signer{
+		Secret:  bytes.Repeat([]byte("a"), 32),
+		TTL:     time.Hour,
+		Metrics: metrics,
+	}
+	expired := Signer{
+		Secret: signer.Secret,
+		nowF:   func() time.Time { return time.Now().Add(-2 * time.Hour) },
+	}
+	other := Signer{
+		Secret: bytes.Repeat([]byte("b"), 32),
+	}
+
+	cases := []struct {
+		Data []byte
+		Kind ErrorKind
+	}{
+		{Data: signer.Gen([]byte("a")), Kind: KindSuccess},
+		{Data: expired.Gen([]byte("a")), Kind: KindExpired},
+		{
+			Data: signer.GenNotBefore(nil, time.Now().Add(time.Hour)),
+			Kind: KindNotYetValid,
+		},
+		{Data: other.Gen([]byte("a")), Kind: KindMismatch},
+		{Data: []byte(strings.Repeat("$", encHeaderLen)), Kind: KindMalformed},
+		{
+			Data: (&Signer{Secret: signer.Secret, Audience: "a"}).Gen(nil),
+			Kind: KindRejected,
+		},
+	}
+	for _, c := range cases {
+		_, _ = signer.Parse(c.Data)
+		ensure.DeepEqual(t, metrics, countingMetrics{c.Kind: 1}, c.Kind)
+		delete(metrics, c.Kind)
+	}
+}
+
+func TestErrorKindString(t *testing.T) {
+	ensure.DeepEqual(t, KindMismatch.String(), "mismatch")
+	ensure.DeepEqual(t, ErrorKind(-1).String(), "unknown")
+}
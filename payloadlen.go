@@ -0,0 +1,61 @@
+package hmacsigner
+
+import "time"
+
+// payloadChunk is the decoded size of the chunks PayloadLen decodes the
+// payload in. It is a multiple of the group size of base64 and base32.
+const payloadChunk = 480
+
+// PayloadLen verifies b like Parse, and returns the length of its payload
+// without keeping the payload in memory.
+func (s *Signer) PayloadLen(b []byte) (int, error) {
+	t := token{lenOnly: true}
+	if err := s.verify(b, &t); err != nil {
+		return 0, err
+	}
+	return t.payloadLen, nil
+}
+
+// checkSigChunks is like checkSig, but decodes the encoded payload b in
+// chunks. It returns the decoded payload length and the number of keys
+// tried.
+func (s *Signer) checkSigChunks(
+	h *header,
+	raw []byte,
+	aad []aadPart,
+	enc Encoding,
+	b []byte,
+	now time.Time,
+) (int, int, error) {
+	if (h.flags&flagAAD != 0) != (aad != nil) {
+		return 0, 0, ErrSignatureMismatch
+	}
+	if err := s.checkFingerprint(h); err != nil {
+		return 0, 0, err
+	}
+	signedLen := len(raw) - sigLen
+	macs, err := s.newMACs(h, raw[:signedLen], aad, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	step := enc.EncodedLen(payloadChunk)
+	chunk := make([]byte, enc.DecodedLen(step))
+	var total int
+	for len(b) > 0 {
+		src := b
+		if len(src) > step {
+			src = src[:step]
+		}
+		n, err := enc.Decode(chunk, src)
+		if err != nil {
+			return 0, len(macs), ErrInvalidEncoding
+		}
+		macs.Write(chunk[:n])
+		total += n
+		b = b[len(src):]
+	}
+	if !macs.matches(raw[signedLen:]) {
+		return 0, len(macs), ErrSignatureMismatch
+	}
+	return total, len(macs), nil
+}
@@ -0,0 +1,50 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestPayloadLen(t *testing.T) {
+	encodings := []Encoding{
+		base64.RawURLEncoding,
+		base64.StdEncoding,
+		Base32Encoding,
+	}
+	for _, enc := range encodings {
+		signer := Signer{
+			Secret:   bytes.Repeat([]byte("a"), 32),
+			TTL:      time.Hour,
+			Encoding: enc,
+		}
+		for _, n := range []int{0, 1, 2, 3, 479, 480, 481, 1000, 4096} {
+			gen := signer.Gen(bytes.Repeat([]byte{byte(n)}, n))
+			l, err := signer.PayloadLen(gen)
+			ensure.Nil(t, err, n)
+			ensure.DeepEqual(t, l, n)
+
+			// The payload is verified.
+			if n > 0 {
+				tampered := append([]byte(nil), gen...)
+				last := len(tampered) - 1
+				for tampered[last] == '=' {
+					last--
+				}
+				tampered[last-1] ^= 1
+				_, err = signer.PayloadLen(tampered)
+				ensure.NotNil(t, err, n)
+			}
+		}
+	}
+
+	signer := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	_, err := signer.PayloadLen(signer.GenAAD([]byte("a"), nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	other := Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}
+	_, err = signer.PayloadLen(other.Gen([]byte("abc")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
@@ -0,0 +1,56 @@
+package hmacsigner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+// period returns the KeyPeriod containing t.
+func (s *Signer) period(t time.Time) int64 {
+	stamp, length := s.stamp(t), int64(s.KeyPeriod)
+	p := stamp / length
+	if stamp%length < 0 {
+		p--
+	}
+	return p
+}
+
+// periodKey returns the key derived from key for the KeyPeriod containing t,
+// or key itself if KeyPeriod is not set.
+func (s *Signer) periodKey(key []byte, t time.Time) []byte {
+	if s.KeyPeriod == 0 {
+		return key
+	}
+	return derivePeriodKey(key, s.period(t))
+}
+
+// periodKeys returns the keys derived from keys which are accepted at now.
+func (s *Signer) periodKeys(keys [][]byte, now time.Time) [][]byte {
+	if s.KeyPeriod == 0 {
+		return keys
+	}
+	current := s.period(now)
+	periods := []int64{current, current - 1}
+	if leeway := s.futureLeeway(); leeway > 0 && s.period(now.Add(leeway)) != current {
+		periods = append(periods, current+1)
+	}
+	derived := make([][]byte, 0, len(keys)*len(periods))
+	for _, key := range keys {
+		for _, p := range periods {
+			derived = append(derived, derivePeriodKey(key, p))
+		}
+	}
+	return derived
+}
+
+// derivePeriodKey derives the key for the numbered period from key.
+func derivePeriodKey(key []byte, period int64) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hmacsigner period "))
+	var p [8]byte
+	binary.LittleEndian.PutUint64(p[:], uint64(period))
+	mac.Write(p[:])
+	return mac.Sum(nil)
+}
@@ -0,0 +1,68 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestKeyPeriod(t *testing.T) {
+	boundary := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	var issue time.Time
+	signer := Signer{
+		Secret:    bytes.Repeat([]byte("a"), 32),
+		TTL:       time.Hour,
+		Leeway:    time.Minute,
+		KeyPeriod: 24 * time.Hour,
+		nowF:      func() time.Time { return issue },
+	}
+	ensure.Nil(t, signer.Validate())
+
+	issue = boundary.Add(-time.Second)
+	before := signer.Gen([]byte("before"))
+	issue = boundary.Add(time.Second)
+	after := signer.Gen([]byte("after"))
+
+	for _, now := range []time.Time{
+		boundary.Add(-time.Millisecond),
+		boundary.Add(2 * time.Second),
+		boundary.Add(30 * time.Minute),
+	} {
+		if now.After(boundary) {
+			payload, err := signer.ParseAt(after, now)
+			ensure.Nil(t, err, now)
+			ensure.DeepEqual(t, string(payload), "after")
+		}
+		payload, err := signer.ParseAt(before, now)
+		ensure.Nil(t, err, now)
+		ensure.DeepEqual(t, string(payload), "before")
+	}
+
+	// A verifier with a clock behind the boundary, within the Leeway.
+	payload, err := signer.ParseAt(after, boundary.Add(-30*time.Second))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "after")
+
+	// Keys differ between periods and from the secret.
+	plain := signer
+	plain.KeyPeriod = 0
+	_, err = plain.ParseAt(after, boundary.Add(2*time.Second))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	// Keys from two periods ago are no longer accepted.
+	lenient := signer
+	lenient.TTL = 72 * time.Hour
+	_, err = lenient.ParseAt(before, boundary.Add(25*time.Hour))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = lenient.ParseAt(before, boundary.Add(23*time.Hour))
+	ensure.Nil(t, err)
+}
+
+func TestPeriodBeforeEpoch(t *testing.T) {
+	signer := Signer{KeyPeriod: time.Hour}
+	ensure.DeepEqual(t, signer.period(time.Unix(0, 0)), int64(0))
+	ensure.DeepEqual(t, signer.period(time.Unix(-1, 0)), int64(-1))
+	ensure.DeepEqual(t, signer.period(time.Unix(3600, 0)), int64(1))
+}
@@ -0,0 +1,76 @@
+package hmacsigner
+
+import "time"
+
+// RawToken is a token decoded by Decode which has not been verified. None of
+// its fields can be trusted until CheckSig succeeds, as anyone can create a
+// token with any of them.
+type RawToken struct {
+	Version  byte
+	Flags    uint16
+	IssuedAt time.Time
+	Salt     [saltLen]byte
+	Payload  []byte
+
+	header    header
+	raw       [maxHeaderLen]byte
+	headerLen int
+	now       time.Time
+}
+
+// Decode decodes b without verifying it, which is the first phase of Parse.
+// It allows doing work between the phases, such as recording metrics, or
+// checking them in a custom order. Parse performs the same checks as Decode
+// followed by CheckSig and CheckTime, but does so in a single pass and also
+// records Metrics. The token is checked as of the time of the call.
+//
+// With LegacyEncodings, Decode uses the first encoding the token decodes
+// with, while Parse uses the first it decodes and verifies with. A token
+// which happens to decode with an earlier encoding than the one it was
+// generated with is then rejected by CheckSig, though Parse accepts it.
+func (s *Signer) Decode(b []byte) (*RawToken, error) {
+	rt := &RawToken{now: time.Now()}
+	err := s.eachEncoding(b, func(enc Encoding, b []byte) error {
+		headerLen, b, err := s.decodeToken(enc, b, &rt.header, rt.raw[:])
+		if err != nil {
+			return err
+		}
+		payload, err := decodePayload(enc, &rt.header, b)
+		if err != nil {
+			return err
+		}
+		rt.headerLen = headerLen
+		rt.Payload = payload
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	h := &rt.header
+	rt.Version = h.version
+	rt.Flags = h.flags
+	rt.IssuedAt = s.time(h.issue)
+	rt.Salt = h.salt
+	return rt, nil
+}
+
+// CheckTime ensures rt is valid as of when it was decoded. Until CheckSig
+// succeeds it only reflects what the token claims, so it is suitable for
+// cheaply discarding expired tokens but not for accepting any.
+func (s *Signer) CheckTime(rt *RawToken) error {
+	return s.checkTime(&rt.header, rt.now, s.acceptedTTL())
+}
+
+// CheckSig verifies the signature of rt over its Payload, along with its
+// signed claims other than its times, such as the Audience. Once it
+// succeeds the fields of rt can be trusted.
+func (s *Signer) CheckSig(rt *RawToken) error {
+	h := &rt.header
+	if _, err := s.checkSig(h, rt.raw[:rt.headerLen], nil, rt.Payload, rt.now); err != nil {
+		return err
+	}
+	if err := checkLength(h, len(rt.Payload)); err != nil {
+		return err
+	}
+	return s.checkScope(h, rt.now, s.acceptedTTL())
+}
@@ -0,0 +1,84 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestPhases(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	claims, err := signer.ParseFull(gen)
+	ensure.Nil(t, err)
+
+	rt, err := signer.Decode(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, rt.Version, claims.Version)
+	ensure.True(t, rt.IssuedAt.Equal(claims.IssuedAt))
+	ensure.DeepEqual(t, rt.Salt, claims.Salt)
+	ensure.DeepEqual(t, rt.Payload, []byte("a@b.c"))
+	ensure.Nil(t, signer.CheckTime(rt))
+	ensure.Nil(t, signer.CheckSig(rt))
+
+	// Decoding does not verify.
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	rt, err = signer.Decode(forged.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, rt.Payload, []byte("a@b.c"))
+	ensure.Nil(t, signer.CheckTime(rt))
+	ensure.DeepEqual(t, signer.CheckSig(rt), ErrSignatureMismatch)
+
+	// A changed payload is not trusted either.
+	rt, err = signer.Decode(gen)
+	ensure.Nil(t, err)
+	rt.Payload = []byte("x@b.c")
+	ensure.DeepEqual(t, signer.CheckSig(rt), ErrSignatureMismatch)
+
+	_, err = signer.Decode([]byte("short"))
+	ensure.DeepEqual(t, err, ErrTooShort)
+}
+
+func TestPhasesMatchParse(t *testing.T) {
+	signer := Signer{
+		Secret:   bytes.Repeat([]byte("a"), 32),
+		TTL:      time.Hour,
+		Audience: "api",
+	}
+	old := signer
+	old.nowF = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	other := signer
+	other.Audience = "web"
+	forged := signer
+	forged.Secret = bytes.Repeat([]byte("b"), 32)
+
+	tokens := [][]byte{
+		signer.Gen([]byte("a@b.c")),
+		signer.Gen(nil),
+		old.Gen([]byte("a@b.c")),
+		other.Gen([]byte("a@b.c")),
+		forged.Gen([]byte("a@b.c")),
+		[]byte("short"),
+	}
+	for i, b := range tokens {
+		expected, parseErr := signer.Parse(b)
+		var actual []byte
+		rt, err := signer.Decode(b)
+		if err == nil {
+			err = signer.CheckSig(rt)
+		}
+		if err == nil {
+			err = signer.CheckTime(rt)
+		}
+		if err == nil {
+			actual = rt.Payload
+		}
+		ensure.DeepEqual(t, kindOf(err), kindOf(parseErr), i)
+		ensure.DeepEqual(t, actual, expected, i)
+	}
+}
@@ -0,0 +1,28 @@
+package hmacsigner
+
+// refreshAAD marks refresh tokens, so they are not accepted in place of
+// access tokens, nor the other way around.
+var refreshAAD = []aadPart{{"refresh", nil}}
+
+// GenRefresh returns a signed refresh token for the payload. It is only
+// accepted by Exchange, using the RefreshTTL.
+func (s *Signer) GenRefresh(payload []byte) []byte {
+	return genOrNil(s.gen(&header{}, refreshAAD, payload))
+}
+
+// Exchange verifies a refresh token generated by GenRefresh, and returns a
+// new token for newPayload as generated by Gen.
+func (s *Signer) Exchange(refresh, newPayload []byte) ([]byte, error) {
+	if err := s.verifyRefresh(refresh); err != nil {
+		return nil, err
+	}
+	return s.gen(&header{}, nil, newPayload)
+}
+
+func (s *Signer) verifyRefresh(b []byte) error {
+	if s.RefreshTTL <= 0 {
+		return ErrInvalidTTL
+	}
+	t := token{aad: refreshAAD, ttl: s.RefreshTTL}
+	return s.verify(b, &t)
+}
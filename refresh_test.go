@@ -0,0 +1,79 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestExchange(t *testing.T) {
+	signer := Signer{
+		Secret:     bytes.Repeat([]byte("a"), 32),
+		TTL:        time.Minute,
+		RefreshTTL: 24 * time.Hour,
+		nowF:       func() time.Time { return time.Now().Add(-time.Hour) },
+	}
+	refresh := signer.GenRefresh([]byte("session"))
+	signer.nowF = nil
+
+	access, err := signer.Exchange(refresh, []byte("a@b.c"))
+	ensure.Nil(t, err)
+	payload, err := signer.Parse(access)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	// Access and refresh tokens are not interchangeable.
+	_, err = signer.Exchange(access, []byte("a@b.c"))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(signer.GenRefresh([]byte("session")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	signer.RefreshTTL = 30 * time.Minute
+	_, err = signer.Exchange(refresh, []byte("a@b.c"))
+	ensure.True(t, errors.Is(err, ErrTimestampExpired), err)
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	_, err = signer.Exchange(forged.GenRefresh(nil), []byte("a@b.c"))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestExchangeWithoutRefreshTTL(t *testing.T) {
+	signer := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	_, err := signer.Exchange(signer.GenRefresh(nil), []byte("a@b.c"))
+	ensure.DeepEqual(t, err, ErrInvalidTTL)
+}
+
+// TestExchangeConcurrent is meant to be run with -race.
+func TestExchangeConcurrent(t *testing.T) {
+	signer := Signer{
+		Secret:               bytes.Repeat([]byte("a"), 32),
+		TTL:                  time.Minute,
+		RefreshTTL:           time.Hour,
+		GuaranteedUniqueSalt: true,
+	}
+	refresh := signer.GenRefresh([]byte("session"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				signer.Gen([]byte("a@b.c"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := signer.Exchange(refresh, []byte("a@b.c")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,93 @@
+package hmacsigner
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReplayed indicates the token was probably verified before.
+var ErrReplayed = errors.New("hmacsigner: token replayed")
+
+const (
+	replayBitsPerEntry = 12
+	replayHashes       = 8
+)
+
+// ReplayFilter is an in process replay guard for a Signer. It remembers the
+// time of issue and salt of verified tokens in a pair of bloom filters, so
+// memory use is fixed and no external storage is needed. Entries age out
+// after one to two TTLs, by which time the tokens have expired anyway.
+//
+// Being a bloom filter, it sometimes flags tokens which were never seen.
+// When each TTL sees at most the capacity it was created with, this happens
+// for about 1% of tokens, increasing quickly beyond that. It is safe for
+// concurrent use, but is not shared across processes.
+type ReplayFilter struct {
+	mu      sync.Mutex
+	bits    [2][]uint64
+	rotated time.Time
+}
+
+// NewReplayFilter returns a ReplayFilter sized for capacity tokens per TTL.
+func NewReplayFilter(capacity int) *ReplayFilter {
+	words := (capacity*replayBitsPerEntry + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &ReplayFilter{
+		bits: [2][]uint64{make([]uint64, words), make([]uint64, words)},
+	}
+}
+
+// seen records the token with the header h at now, and reports if it was
+// probably recorded before. Entries are kept for at least period.
+func (f *ReplayFilter) seen(h *header, now time.Time, period time.Duration) bool {
+	h1 := mix64(uint64(h.issue))
+	h2 := mix64(h1^binary.LittleEndian.Uint64(h.salt[:])) | 1
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if age := now.Sub(f.rotated); age >= period || age < 0 {
+		old := f.bits[1]
+		if age >= 2*period || age < 0 {
+			clearBits(f.bits[0])
+		}
+		clearBits(old)
+		f.bits[0], f.bits[1] = old, f.bits[0]
+		f.rotated = now
+	}
+
+	current, previous := f.bits[0], f.bits[1]
+	n := uint64(len(current) * 64)
+	inCurrent, inPrevious := true, true
+	for i := uint64(0); i < replayHashes; i++ {
+		bit := (h1 + i*h2) % n
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if current[word]&mask == 0 {
+			inCurrent = false
+			current[word] |= mask
+		}
+		if previous[word]&mask == 0 {
+			inPrevious = false
+		}
+	}
+	return inCurrent || inPrevious
+}
+
+func clearBits(b []uint64) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
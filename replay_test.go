@@ -0,0 +1,71 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestReplayFilter(t *testing.T) {
+	signer := Signer{
+		Secret:       bytes.Repeat([]byte("a"), 32),
+		TTL:          time.Hour,
+		ReplayFilter: NewReplayFilter(100),
+	}
+	a := signer.Gen([]byte("a@b.c"))
+	b := signer.Gen([]byte("a@b.c"))
+
+	_, err := signer.Parse(a)
+	ensure.Nil(t, err)
+	_, err = signer.Parse(b)
+	ensure.Nil(t, err)
+	_, err = signer.Parse(a)
+	ensure.DeepEqual(t, err, ErrReplayed)
+	ensure.DeepEqual(t, kindOf(err), KindRejected)
+
+	// Forged tokens are not recorded.
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	c := signer.Gen(nil)
+	_, err = signer.Parse(forged.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(c)
+	ensure.Nil(t, err)
+}
+
+func TestReplayFilterAging(t *testing.T) {
+	f := NewReplayFilter(10)
+	now := time.Now()
+	h := header{issue: now.UnixNano()}
+	ensure.False(t, f.seen(&h, now, time.Hour))
+	ensure.True(t, f.seen(&h, now.Add(59*time.Minute), time.Hour))
+	ensure.True(t, f.seen(&h, now.Add(90*time.Minute), time.Hour))
+	ensure.False(t, f.seen(&h, now.Add(5*time.Hour), time.Hour))
+}
+
+func TestReplayFilterFalsePositives(t *testing.T) {
+	const capacity = 1000
+	f := NewReplayFilter(capacity)
+	now := time.Now()
+	var h header
+	for i := 0; i < capacity; i++ {
+		h.issue = int64(i)
+		binary.LittleEndian.PutUint64(h.salt[:], uint64(i))
+		f.seen(&h, now, time.Hour)
+	}
+
+	// Probe without recording the probes.
+	full := append([]uint64(nil), f.bits[0]...)
+	var flagged int
+	for i := capacity; i < 11*capacity; i++ {
+		h.issue = int64(i)
+		binary.LittleEndian.PutUint64(h.salt[:], uint64(i))
+		if f.seen(&h, now, time.Hour) {
+			flagged++
+		}
+		copy(f.bits[0], full)
+	}
+	ensure.True(t, flagged < capacity/5, flagged)
+}
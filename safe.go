@@ -0,0 +1,37 @@
+package hmacsigner
+
+import "fmt"
+
+// SafeGen is like Gen, but returns an error instead of panicking, for
+// example if the secret is too short or the random source fails.
+func (s *Signer) SafeGen(payload []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, panicErr(r)
+		}
+	}()
+	return s.gen(&header{}, nil, payload)
+}
+
+// SafeGenAAD is like GenAAD, but returns an error instead of panicking.
+func (s *Signer) SafeGenAAD(payload, aad []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, panicErr(r)
+		}
+	}()
+	return s.gen(&header{}, []aadPart{{"aad", aad}}, payload)
+}
+
+// panicErr converts a recovered panic value into an error.
+func panicErr(r interface{}) error {
+	switch v := r.(type) {
+	case error:
+		return v
+	case string:
+		if v == shortSecretPanic {
+			return ErrSecretTooShort
+		}
+	}
+	return fmt.Errorf("hmacsigner: %v", r)
+}
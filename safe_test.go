@@ -0,0 +1,148 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestSafeGen(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen, err := signer.SafeGen([]byte("a@b.c"))
+	ensure.Nil(t, err)
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	short := Signer{Secret: []byte("short")}
+	gen, err = short.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	ensure.True(t, gen == nil)
+
+	errRand := errors.New("rand failed")
+	broken := signer
+	broken.saltF = func([]byte) { panic(errRand) }
+	_, err = broken.SafeGen(nil)
+	ensure.DeepEqual(t, err, errRand)
+
+	broken.saltF = func([]byte) { panic(42) }
+	_, err = broken.SafeGen(nil)
+	ensure.DeepEqual(t, err.Error(), "hmacsigner: 42")
+
+	regressed := signer
+	regressed.RejectClockRegression = true
+	regressed.lastIssue = time.Now().Add(time.Hour).UnixNano()
+	_, err = regressed.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrClockWentBackwards)
+}
+
+func TestPanicOnMisconfig(t *testing.T) {
+	short := Signer{Secret: []byte("short"), TTL: time.Hour}
+	func() {
+		defer ensure.PanicDeepEqual(t, shortSecretPanic)
+		short.Gen(nil)
+	}()
+
+	PanicOnMisconfig = false
+	defer func() { PanicOnMisconfig = true }()
+	ensure.True(t, short.Gen([]byte("a@b.c")) == nil)
+	ensure.True(t, short.GenDetached([]byte("a@b.c")) == nil)
+	ensure.DeepEqual(t, short.AppendGen([]byte("x"), nil), []byte("x"))
+	_, err := short.GenDetachedReader(bytes.NewReader(nil))
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	_, err = short.GenValue("a@b.c")
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	_, err = short.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	for _, gen := range short.GenMany(nil, [][]byte{nil, nil}) {
+		ensure.True(t, gen == nil)
+	}
+
+	regressed := Signer{
+		Secret:                bytes.Repeat([]byte("a"), 32),
+		TTL:                   time.Hour,
+		RejectClockRegression: true,
+		lastIssue:             time.Now().Add(time.Hour).UnixNano(),
+	}
+	ensure.True(t, regressed.Gen(nil) == nil)
+	_, err = regressed.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrClockWentBackwards)
+
+	// Valid configurations are unaffected.
+	short.Secret = bytes.Repeat([]byte("a"), 32)
+	payload, err := short.Parse(short.Gen([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+}
+
+func TestVerifyOnly(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	verifier := signer
+	verifier.VerifyOnly = true
+
+	payload, err := verifier.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	func() {
+		defer ensure.PanicDeepEqual(t, ErrGenDisabled)
+		verifier.Gen(nil)
+	}()
+	_, err = verifier.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrGenDisabled)
+
+	PanicOnMisconfig = false
+	defer func() { PanicOnMisconfig = true }()
+	ensure.True(t, verifier.Gen(nil) == nil)
+	_, err = verifier.SafeGen(nil)
+	ensure.DeepEqual(t, err, ErrGenDisabled)
+	_, err = verifier.GenValue("a@b.c")
+	ensure.DeepEqual(t, err, ErrGenDisabled)
+	_, err = verifier.GenDetachedReader(bytes.NewReader(nil))
+	ensure.DeepEqual(t, err, ErrGenDisabled)
+	ensure.DeepEqual(t, verifier.NewEncoder(ioutil.Discard).Encode(nil),
+		ErrGenDisabled)
+}
+
+// flakySecrets fails every other call.
+type flakySecrets struct {
+	calls int
+}
+
+func (f *flakySecrets) Secrets() ([][]byte, error) {
+	f.calls++
+	if f.calls%2 == 1 {
+		return nil, errFlaky
+	}
+	return [][]byte{bytes.Repeat([]byte("a"), 32)}, nil
+}
+
+var errFlaky = errors.New("flaky")
+
+func TestTransientProviderError(t *testing.T) {
+	PanicOnMisconfig = false
+	defer func() { PanicOnMisconfig = true }()
+	signer := Signer{SecretProvider: &flakySecrets{}, TTL: time.Hour}
+
+	_, err := signer.GenValue("a@b.c")
+	ensure.DeepEqual(t, err, errFlaky)
+	signer.SecretProvider = &flakySecrets{}
+	_, err = signer.SafeGen(nil)
+	ensure.DeepEqual(t, err, errFlaky)
+	signer.SecretProvider = &flakySecrets{}
+	_, err = signer.GenTo(ioutil.Discard, nil)
+	ensure.DeepEqual(t, err, errFlaky)
+	signer.SecretProvider = &flakySecrets{}
+	ensure.DeepEqual(t, signer.NewEncoder(ioutil.Discard).Encode(nil), errFlaky)
+}
@@ -0,0 +1,274 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SecretProvider supplies the secrets used by a Signer. The first secret is
+// used by Gen, and all of them are accepted by Parse, which allows rotating
+// the secret without invalidating issued tokens.
+type SecretProvider interface {
+	Secrets() ([][]byte, error)
+}
+
+// ReloadingSecret is a SecretProvider which periodically reloads the secret,
+// so it can be rotated without a restart. It is safe for concurrent use.
+type ReloadingSecret struct {
+	// Load returns the current secret, for example by reading a file or an
+	// environment variable. Secrets shorter than 32 bytes are rejected.
+	Load func() ([]byte, error)
+
+	// Interval is how long a loaded secret is used before calling Load again.
+	Interval time.Duration
+
+	// Previous is how many of the secrets replaced by a rotation continue to
+	// be accepted by Parse.
+	Previous int
+
+	mu      sync.Mutex
+	loaded  time.Time
+	secrets [][]byte
+	nowF    func() time.Time
+}
+
+func (r *ReloadingSecret) now() time.Time {
+	if r.nowF == nil {
+		return time.Now()
+	}
+	return r.nowF()
+}
+
+// Secrets returns the current secret followed by the previous ones. If a
+// reload fails after a secret has been loaded, the cached secrets continue to
+// be used and the reload is retried on the next call.
+func (r *ReloadingSecret) Secrets() ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.secrets != nil && now.Sub(r.loaded) < r.Interval {
+		return r.secrets, nil
+	}
+	secret, err := r.Load()
+	if err == nil && len(secret) < minSecretLen {
+		err = ErrSecretTooShort
+	}
+	if err != nil {
+		if r.secrets == nil {
+			return nil, err
+		}
+		return r.secrets, nil
+	}
+	r.loaded = now
+	if r.secrets != nil && bytes.Equal(secret, r.secrets[0]) {
+		return r.secrets, nil
+	}
+
+	// Build a new slice since earlier ones may still be in use.
+	secrets := [][]byte{secret}
+	for _, old := range r.secrets {
+		if len(secrets) > r.Previous {
+			break
+		}
+		secrets = append(secrets, old)
+	}
+	r.secrets = secrets
+	return secrets, nil
+}
+
+// shortSecretPanic is the value Gen panics with for a short secret.
+var shortSecretPanic = fmt.Sprintf("secret less than %v bytes", minSecretLen)
+
+// PanicOnMisconfig makes Gen panic when the secret is unavailable or too
+// short, the Signer is VerifyOnly, or RejectClockRegression catches the
+// clock going backwards, which is the default. When false, Gen returns nil
+// instead, and SafeGen returns the SecretProvider's error,
+// ErrSecretTooShort, ErrGenDisabled or ErrClockWentBackwards. It is shared
+// by all Signers.
+var PanicOnMisconfig = true
+
+// signingSecret returns the secret used to generate tokens. It panics if the
+// secret is unavailable or too short, or the Signer is VerifyOnly, and
+// PanicOnMisconfig is set. Otherwise those are reported as the
+// SecretProvider's error, ErrSecretTooShort and ErrGenDisabled.
+func (s *Signer) signingSecret() ([]byte, error) {
+	if s.VerifyOnly {
+		if !PanicOnMisconfig {
+			return nil, ErrGenDisabled
+		}
+		panic(ErrGenDisabled)
+	}
+	secret := s.Secret
+	if s.SecretProvider != nil {
+		secrets, err := s.SecretProvider.Secrets()
+		if err != nil {
+			if !PanicOnMisconfig {
+				return nil, err
+			}
+			panic(err)
+		}
+		secret = nil
+		if len(secrets) > 0 {
+			secret = secrets[0]
+		}
+	}
+	if len(secret) < minSecretLen {
+		if !PanicOnMisconfig {
+			return nil, ErrSecretTooShort
+		}
+		panic(shortSecretPanic)
+	}
+	if s.Logf != nil && len(secret) < RecommendedSecretLen &&
+		atomic.CompareAndSwapUint32(&s.warnedShort, 0, 1) {
+		s.Logf("hmacsigner: secret is %v bytes, at least %v are recommended",
+			len(secret), RecommendedSecretLen)
+	}
+	return s.key(secret), nil
+}
+
+// rawSecrets returns the configured secrets accepted when verifying tokens.
+func (s *Signer) rawSecrets() ([][]byte, error) {
+	if s.SecretProvider == nil {
+		return [][]byte{s.Secret}, nil
+	}
+	return s.SecretProvider.Secrets()
+}
+
+// secrets returns the keys accepted when verifying the token with the header
+// h at now.
+func (s *Signer) secrets(h *header, now time.Time) ([][]byte, error) {
+	keys, err := s.keys(h)
+	if err != nil {
+		return nil, err
+	}
+	return s.periodKeys(keys, now), nil
+}
+
+// tokenSecrets returns the secrets accepted for the token with the header h,
+// which are the configured ones if h is nil.
+func (s *Signer) tokenSecrets(h *header) ([][]byte, error) {
+	if h == nil || s.ResolveSecret == nil {
+		return s.rawSecrets()
+	}
+	secret, err := s.ResolveSecret(h.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{secret}, nil
+}
+
+// keys returns the keys derived from the secrets accepted for the token with
+// the header h, before any KeyPeriod derivation. If h is nil they are derived
+// from the configured secrets.
+func (s *Signer) keys(h *header) ([][]byte, error) {
+	secrets, err := s.tokenSecrets(h)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if len(secret) < minSecretLen {
+			return nil, ErrSecretTooShort
+		}
+	}
+	if s.StretchSecret || len(s.Pepper) != 0 || len(s.BootID) != 0 {
+		keys := make([][]byte, len(secrets))
+		for i, secret := range secrets {
+			keys[i] = s.key(secret)
+		}
+		secrets = keys
+	}
+	return secrets, nil
+}
+
+// Which returns the index of the first of secrets which verifies token, along
+// with its payload. It returns an index of -1 and ErrSignatureMismatch if none
+// of them do, and other errors as soon as they are encountered.
+func Which(secrets [][]byte, ttl time.Duration, token []byte) (int, []byte, error) {
+	for i, secret := range secrets {
+		s := Signer{Secret: secret, TTL: ttl}
+		payload, err := s.Parse(token)
+		if err == ErrSignatureMismatch {
+			continue
+		}
+		if err != nil {
+			return -1, nil, err
+		}
+		return i, payload, nil
+	}
+	return -1, nil, ErrSignatureMismatch
+}
+
+// Close zeroes the Secret, the Pepper and any keys derived from them.
+// Secrets supplied by a SecretProvider are not affected. The BootID is
+// cleared but not zeroed, since it is not secret and is typically shared by
+// all the Signers of the process. The Signer must not be used after Close:
+// Gen will panic and Parse will return ErrSecretTooShort.
+func (s *Signer) Close() {
+	zero(s.Secret)
+	s.Secret = nil
+	zero(s.Pepper)
+	s.Pepper = nil
+	s.BootID = nil
+	cache, _ := s.stretched.Load().([]stretched)
+	for _, c := range cache {
+		zero(c.secret)
+		zero(c.key)
+	}
+	s.stretched.Store([]stretched(nil))
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// keyFingerprint returns the fingerprint of a key included in the header
+// when Fingerprint is set.
+func keyFingerprint(key []byte) [fingerprintLen]byte {
+	var fp [fingerprintLen]byte
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hmacsigner fingerprint"))
+	copy(fp[:], mac.Sum(nil))
+	return fp
+}
+
+// checkFingerprint ensures a fingerprint in the header h matches one of the
+// accepted keys.
+func (s *Signer) checkFingerprint(h *header) error {
+	if h.flags&flagFingerprint == 0 {
+		return nil
+	}
+	keys, err := s.keys(h)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if keyFingerprint(key) == h.fingerprint {
+			return nil
+		}
+	}
+	return ErrWrongSecret
+}
+
+// ResignPreservingTime verifies b with from, and returns it signed by to
+// while keeping its original time of issue, so it expires at the same time.
+// A not before time is preserved too.
+func ResignPreservingTime(from, to *Signer, b []byte) ([]byte, error) {
+	var t token
+	if err := from.verify(b, &t); err != nil {
+		return nil, err
+	}
+	issue := from.time(t.header.issue)
+	h := header{flags: t.header.flags & (flagNotBefore | flagSegments)}
+	if h.flags&flagNotBefore != 0 {
+		h.notBefore = to.stamp(from.time(t.header.notBefore))
+	}
+	return to.appendGenAt(nil, &h, nil, t.payload, issue)
+}
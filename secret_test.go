@@ -0,0 +1,421 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+type staticSecrets [][]byte
+
+func (s staticSecrets) Secrets() ([][]byte, error) {
+	return s, nil
+}
+
+func TestReloadingSecretRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmacsigner")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "secret")
+	ensure.Nil(t, ioutil.WriteFile(file, bytes.Repeat([]byte("a"), 32), 0600))
+
+	now := time.Now()
+	provider := &ReloadingSecret{
+		Load:     func() ([]byte, error) { return ioutil.ReadFile(file) },
+		Interval: time.Minute,
+		Previous: 1,
+		nowF:     func() time.Time { return now },
+	}
+	signer := Signer{SecretProvider: provider, TTL: time.Hour}
+	oldToken := signer.Gen([]byte("old"))
+
+	// Cached until the interval passes.
+	ensure.Nil(t, ioutil.WriteFile(file, bytes.Repeat([]byte("b"), 32), 0600))
+	_, err = signer.Parse(oldToken)
+	ensure.Nil(t, err)
+	now = now.Add(time.Minute)
+	newToken := signer.Gen([]byte("new"))
+
+	payload, err := signer.Parse(oldToken)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "old")
+	payload, err = signer.Parse(newToken)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "new")
+
+	// New tokens use the new secret.
+	_, err = (&Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}).
+		Parse(newToken)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	payload, err = (&Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}).
+		Parse(newToken)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "new")
+
+	// A second rotation drops the oldest secret.
+	ensure.Nil(t, ioutil.WriteFile(file, bytes.Repeat([]byte("c"), 32), 0600))
+	now = now.Add(time.Minute)
+	_, err = signer.Parse(oldToken)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(newToken)
+	ensure.Nil(t, err)
+}
+
+func TestReloadingSecretLoadFailure(t *testing.T) {
+	now := time.Now()
+	var secret []byte
+	var loadErr error
+	provider := &ReloadingSecret{
+		Load:     func() ([]byte, error) { return secret, loadErr },
+		Interval: time.Minute,
+		nowF:     func() time.Time { return now },
+	}
+
+	_, err := provider.Secrets()
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	loadErr = errors.New("no secret")
+	_, err = provider.Secrets()
+	ensure.DeepEqual(t, err, loadErr)
+
+	// Failures after a successful load keep the cached secret.
+	secret, loadErr = bytes.Repeat([]byte("a"), 32), nil
+	secrets, err := provider.Secrets()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, secrets, [][]byte{secret})
+	now = now.Add(time.Minute)
+	secret = []byte("short")
+	secrets, err = provider.Secrets()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, secrets, [][]byte{bytes.Repeat([]byte("a"), 32)})
+}
+
+func TestReloadingSecretConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	secret := bytes.Repeat([]byte("a"), 32)
+	provider := &ReloadingSecret{
+		Load: func() ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return secret, nil
+		},
+		Previous: 1,
+	}
+	signer := Signer{SecretProvider: provider, TTL: time.Hour}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i == 0 && j == 50 {
+					mu.Lock()
+					secret = bytes.Repeat([]byte("b"), 32)
+					mu.Unlock()
+				}
+				_, err := signer.Parse(signer.Gen([]byte("payload")))
+				ensure.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSecretProviderErrors(t *testing.T) {
+	errNoSecret := errors.New("no secret")
+	provider := &ReloadingSecret{
+		Load: func() ([]byte, error) { return nil, errNoSecret },
+	}
+	signer := Signer{SecretProvider: provider, TTL: time.Hour}
+	ensure.Err(t, signer.Validate(), regexp.MustCompile("no secret"))
+	other := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	_, err := signer.Parse(other.Gen(nil))
+	ensure.DeepEqual(t, err, errNoSecret)
+	func() {
+		defer ensure.PanicDeepEqual(t, errNoSecret)
+		signer.Gen(nil)
+	}()
+
+	PanicOnMisconfig = false
+	defer func() { PanicOnMisconfig = true }()
+	ensure.True(t, signer.Gen(nil) == nil)
+	_, err = signer.SafeGen(nil)
+	ensure.DeepEqual(t, err, errNoSecret)
+}
+
+func TestWhich(t *testing.T) {
+	var secrets [][]byte
+	for i := 0; i < 5; i++ {
+		secrets = append(secrets, bytes.Repeat([]byte{byte('a' + i)}, 32))
+	}
+	signer := Signer{Secret: secrets[2], TTL: time.Hour}
+	token := signer.Gen([]byte("payload"))
+
+	i, payload, err := Which(secrets, time.Hour, token)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, i, 2)
+	ensure.DeepEqual(t, string(payload), "payload")
+
+	i, payload, err = Which(secrets[3:], time.Hour, token)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.DeepEqual(t, i, -1)
+	ensure.True(t, payload == nil)
+
+	i, _, err = Which(secrets, time.Hour, []byte("garbage"))
+	ensure.DeepEqual(t, err, ErrTooShort)
+	ensure.DeepEqual(t, i, -1)
+}
+
+func TestClose(t *testing.T) {
+	secret := bytes.Repeat([]byte("a"), 32)
+	signer := Signer{Secret: secret, TTL: time.Hour, StretchSecret: true}
+	gen := signer.Gen([]byte("payload"))
+	cache := signer.stretched.Load().([]stretched)
+	key := cache[0].key
+
+	bootID := []byte("boot")
+	signer.BootID = bootID
+	signer.Close()
+	ensure.DeepEqual(t, secret, make([]byte, 32))
+	ensure.DeepEqual(t, key, make([]byte, len(key)))
+	ensure.DeepEqual(t, bootID, []byte("boot"))
+	ensure.True(t, signer.BootID == nil)
+	_, err := signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+	defer ensure.PanicDeepEqual(t, "secret less than 32 bytes")
+	signer.Gen(nil)
+}
+
+func TestPepper(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		Pepper: []byte("pepper"),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("payload"))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "payload")
+
+	other := signer
+	other.Pepper = []byte("peppes")
+	_, err = other.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	other.Pepper = nil
+	_, err = other.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	// Neither the secret nor the pepper alone is the key.
+	for _, key := range [][]byte{signer.Secret, bytes.Repeat(signer.Pepper, 6)} {
+		forged := Signer{Secret: key, TTL: time.Hour}
+		_, err = signer.Parse(forged.Gen([]byte("payload")))
+		ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	}
+
+	stretched := signer
+	stretched.StretchSecret = true
+	payload, err = stretched.Parse(stretched.Gen([]byte("payload")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "payload")
+	_, err = stretched.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestBootID(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		BootID: []byte("boot 1"),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("payload"))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "payload")
+
+	restarted := signer
+	restarted.BootID = []byte("boot 2")
+	_, err = restarted.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(restarted.Gen([]byte("payload")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	restarted.BootID = nil
+	_, err = restarted.Parse(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = signer.Parse(restarted.Gen([]byte("payload")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestFingerprint(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		Fingerprint: true,
+	}
+	gen := signer.Gen([]byte("payload"))
+	ensure.DeepEqual(t, len(gen), signer.EncodedLen(7))
+	payload, err := signer.Parse(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "payload")
+
+	wrong := signer
+	wrong.Secret = bytes.Repeat([]byte("b"), 32)
+	_, err = wrong.Parse(gen)
+	ensure.DeepEqual(t, err, ErrWrongSecret)
+	_, err = wrong.PayloadLen(gen)
+	ensure.DeepEqual(t, err, ErrWrongSecret)
+	ensure.DeepEqual(t,
+		wrong.VerifyDetachedReader(signer.GenDetached([]byte("payload")),
+			bytes.NewReader([]byte("payload"))),
+		ErrWrongSecret)
+
+	// Tokens without a fingerprint are still checked normally.
+	plain := wrong
+	plain.Fingerprint = false
+	_, err = signer.Parse(plain.Gen([]byte("payload")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	// Any of the accepted secrets match.
+	rotated := signer
+	rotated.Secret = nil
+	rotated.SecretProvider = staticSecrets{
+		bytes.Repeat([]byte("c"), 32),
+		signer.Secret,
+	}
+	_, err = rotated.Parse(gen)
+	ensure.Nil(t, err)
+}
+
+func TestResignPreservingTime(t *testing.T) {
+	issue := time.Now().Add(-30 * time.Minute)
+	from := &Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return issue },
+	}
+	to := &Signer{
+		Secret: bytes.Repeat([]byte("b"), 32),
+		TTL:    time.Hour,
+		Epoch:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	notBefore := issue.Add(time.Minute)
+	for _, token := range [][]byte{
+		from.Gen([]byte("a@b.c")),
+		from.GenNotBefore([]byte("a@b.c"), notBefore),
+	} {
+		resigned, err := ResignPreservingTime(from, to, token)
+		ensure.Nil(t, err)
+		claims, err := to.ParseFull(resigned)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(claims.Payload), "a@b.c")
+		ensure.True(t, claims.IssuedAt.Equal(issue), claims.IssuedAt)
+		if !claims.NotBefore.IsZero() {
+			ensure.True(t, claims.NotBefore.Equal(notBefore), claims.NotBefore)
+		}
+		_, err = from.Parse(resigned)
+		ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	}
+
+	_, err := ResignPreservingTime(to, from, from.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.True(t, to.nowF == nil)
+}
+
+func TestParseWithCost(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("hello"))
+
+	payload, cost, err := signer.ParseWithCost(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("hello"))
+	ensure.DeepEqual(t, cost, 1)
+
+	rotated := signer
+	rotated.SecretProvider = staticSecrets{
+		bytes.Repeat([]byte("c"), 32),
+		bytes.Repeat([]byte("b"), 32),
+		signer.Secret,
+	}
+	_, cost, err = rotated.ParseWithCost(gen)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, cost, 3)
+
+	_, cost, err = rotated.ParseWithCost(signer.Gen([]byte("hello!")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, cost, 3)
+
+	rotated.SecretProvider = staticSecrets{
+		bytes.Repeat([]byte("c"), 32),
+		bytes.Repeat([]byte("b"), 32),
+	}
+	_, cost, err = rotated.ParseWithCost(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.DeepEqual(t, cost, 2)
+
+	_, cost, err = signer.ParseWithCost([]byte("garbage"))
+	ensure.NotNil(t, err)
+	ensure.DeepEqual(t, cost, 0)
+
+	signer.UniformTiming = true
+	_, cost, err = signer.ParseWithCost([]byte("garbage"))
+	ensure.NotNil(t, err)
+	ensure.DeepEqual(t, cost, 1)
+}
+
+func TestResolveSecret(t *testing.T) {
+	tenants := map[byte][]byte{
+		1: bytes.Repeat([]byte("a"), 32),
+		2: bytes.Repeat([]byte("b"), 32),
+	}
+	errUnknownTenant := errors.New("unknown tenant")
+	var resolved []byte
+	verifier := Signer{
+		TTL: time.Hour,
+		ResolveSecret: func(keyID byte) ([]byte, error) {
+			resolved = append(resolved, keyID)
+			if secret, ok := tenants[keyID]; ok {
+				return secret, nil
+			}
+			return nil, errUnknownTenant
+		},
+	}
+	ensure.Nil(t, verifier.Validate())
+	for keyID, secret := range tenants {
+		tenant := Signer{Secret: secret, TTL: time.Hour, KeyID: keyID}
+		claims, err := verifier.ParseFull(tenant.Gen([]byte("a@b.c")))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, claims.KeyID, keyID)
+		ensure.DeepEqual(t, claims.Payload, []byte("a@b.c"))
+	}
+
+	// A token claiming another tenant's key ID fails verification.
+	forged := Signer{Secret: tenants[1], TTL: time.Hour, KeyID: 2}
+	_, err := verifier.Parse(forged.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	unknown := Signer{Secret: tenants[1], TTL: time.Hour, KeyID: 3}
+	_, err = verifier.Parse(unknown.Gen(nil))
+	ensure.DeepEqual(t, err, errUnknownTenant)
+	_, err = verifier.Parse((&Signer{Secret: tenants[1], TTL: time.Hour}).Gen(nil))
+	ensure.DeepEqual(t, err, errUnknownTenant)
+	ensure.DeepEqual(t, resolved[len(resolved)-3:], []byte{2, 3, 0})
+
+	short := verifier
+	short.ResolveSecret = func(byte) ([]byte, error) { return []byte("short"), nil }
+	_, err = short.Parse(forged.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSecretTooShort)
+
+	// A Secret alongside ResolveSecret is still checked.
+	short.Secret = []byte("short")
+	ensure.DeepEqual(t, short.Validate(), ErrSecretTooShort)
+}
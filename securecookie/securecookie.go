@@ -0,0 +1,49 @@
+// Package securecookie provides an interface similar to
+// github.com/gorilla/securecookie, backed by hmacsigner.
+//
+// The cookie name is bound to the value as associated data, so a value
+// encoded for one cookie can't be used as another. Values are serialized
+// using the Codec of the Signer.
+package securecookie
+
+import "github.com/daaku/hmacsigner"
+
+// SecureCookie encodes and decodes signed cookie values.
+type SecureCookie struct {
+	signer *hmacsigner.Signer
+}
+
+// New returns a SecureCookie using the given Signer.
+func New(signer *hmacsigner.Signer) *SecureCookie {
+	return &SecureCookie{signer: signer}
+}
+
+func (c *SecureCookie) codec() hmacsigner.PayloadCodec {
+	if c.signer.Codec == nil {
+		return hmacsigner.JSONCodec
+	}
+	return c.signer.Codec
+}
+
+// Encode serializes and signs the value for the named cookie.
+func (c *SecureCookie) Encode(name string, value interface{}) (string, error) {
+	payload, err := c.codec().Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	gen, err := c.signer.SafeGenAAD(payload, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(gen), nil
+}
+
+// Decode verifies the value of the named cookie and deserializes it into
+// dst.
+func (c *SecureCookie) Decode(name, value string, dst interface{}) error {
+	payload, err := c.signer.ParseAAD([]byte(value), []byte(name))
+	if err != nil {
+		return err
+	}
+	return c.codec().Unmarshal(payload, dst)
+}
@@ -0,0 +1,90 @@
+package securecookie
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+	"github.com/daaku/hmacsigner"
+)
+
+func newSecureCookie() *SecureCookie {
+	return New(&hmacsigner.Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	})
+}
+
+func TestEncodeDecode(t *testing.T) {
+	s := newSecureCookie()
+	value := map[string]string{"foo": "bar"}
+	encoded, err := s.Encode("cookie-name", value)
+	ensure.Nil(t, err)
+
+	var actual map[string]string
+	ensure.Nil(t, s.Decode("cookie-name", encoded, &actual))
+	ensure.DeepEqual(t, actual, value)
+}
+
+func TestDecodeWrongName(t *testing.T) {
+	s := newSecureCookie()
+	encoded, err := s.Encode("cookie-name", "value")
+	ensure.Nil(t, err)
+
+	var actual string
+	ensure.DeepEqual(t, s.Decode("other-name", encoded, &actual),
+		hmacsigner.ErrSignatureMismatch)
+}
+
+func TestDecodeTampered(t *testing.T) {
+	s := newSecureCookie()
+	encoded, err := s.Encode("cookie-name", "value")
+	ensure.Nil(t, err)
+
+	var actual string
+	tampered := encoded[:len(encoded)-1] + "A"
+	ensure.DeepEqual(t, s.Decode("cookie-name", tampered, &actual),
+		hmacsigner.ErrSignatureMismatch)
+	ensure.DeepEqual(t, s.Decode("cookie-name", "", &actual),
+		hmacsigner.ErrTooShort)
+}
+
+func TestEncodeError(t *testing.T) {
+	_, err := newSecureCookie().Encode("cookie-name", make(chan int))
+	ensure.NotNil(t, err)
+}
+
+func TestEncodeProviderError(t *testing.T) {
+	errNoSecret := errors.New("no secret")
+	s := New(&hmacsigner.Signer{
+		SecretProvider: &hmacsigner.ReloadingSecret{
+			Load: func() ([]byte, error) { return nil, errNoSecret },
+		},
+		TTL: time.Hour,
+	})
+	_, err := s.Encode("cookie-name", "a@b.c")
+	ensure.DeepEqual(t, err, errNoSecret)
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	s := newSecureCookie()
+	value := map[string]string{"user": "a@b.c"}
+
+	w := httptest.NewRecorder()
+	encoded, err := s.Encode("session", value)
+	ensure.Nil(t, err)
+	http.SetCookie(w, &http.Cookie{Name: "session", Value: encoded})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	cookie, err := r.Cookie("session")
+	ensure.Nil(t, err)
+
+	var actual map[string]string
+	ensure.Nil(t, s.Decode("session", cookie.Value, &actual))
+	ensure.DeepEqual(t, actual, value)
+}
@@ -0,0 +1,104 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestWithSeed(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	a, b := signer.WithSeed(42), signer.WithSeed(42)
+	first := a.Gen([]byte("a@b.c"))
+	ensure.DeepEqual(t, string(b.Gen([]byte("a@b.c"))), string(first))
+	second := a.Gen([]byte("a@b.c"))
+	ensure.NotDeepEqual(t, string(second), string(first))
+	ensure.DeepEqual(t, string(b.Gen([]byte("a@b.c"))), string(second))
+	ensure.NotDeepEqual(t,
+		string(signer.WithSeed(43).Gen([]byte("a@b.c"))), string(first))
+
+	payload, err := signer.ParseAt(first, SeedTime)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "a@b.c")
+
+	// The original is unaffected.
+	ensure.True(t, signer.nowF == nil)
+	ensure.True(t, signer.saltF == nil)
+}
+
+func TestExpectSalt(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	var expected [][saltLen]byte
+	seeded := signer.WithSeed(42)
+	for i := 0; i < 2; i++ {
+		var salt [saltLen]byte
+		seeded.salt(salt[:])
+		expected = append(expected, salt)
+	}
+	signer.ExpectSalt = func(salt [saltLen]byte) bool {
+		for _, e := range expected {
+			if salt == e {
+				return true
+			}
+		}
+		return false
+	}
+
+	seeded = signer.WithSeed(42)
+	for i := 0; i < 2; i++ {
+		_, err := signer.ParseAt(seeded.Gen([]byte("a@b.c")), SeedTime)
+		ensure.Nil(t, err)
+	}
+	_, err := signer.ParseAt(seeded.Gen([]byte("a@b.c")), SeedTime)
+	ensure.DeepEqual(t, err, ErrUnexpectedSalt)
+
+	// A random salt, as if the seed was forgotten.
+	_, err = signer.Parse(signer.Gen([]byte("a@b.c")))
+	ensure.DeepEqual(t, err, ErrUnexpectedSalt)
+	ensure.DeepEqual(t, kindOf(err), KindRejected)
+}
+
+func TestOnGen(t *testing.T) {
+	var salts [][saltLen]byte
+	var issues []time.Time
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		OnGen: func(salt [saltLen]byte, issued time.Time) {
+			salts = append(salts, salt)
+			issues = append(issues, issued)
+		},
+	}
+	gens := [][]byte{
+		signer.Gen([]byte("a@b.c")),
+		signer.GenAAD(nil, []byte("aad")),
+	}
+	detached, err := signer.GenDetachedReader(bytes.NewReader([]byte("a@b.c")))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(salts), 3)
+
+	for i, gen := range gens {
+		var aad []aadPart
+		if i == 1 {
+			aad = []aadPart{{"aad", []byte("aad")}}
+		}
+		tok := token{aad: aad}
+		ensure.Nil(t, signer.verify(gen, &tok))
+		claims := signer.claims(&tok)
+		ensure.DeepEqual(t, claims.Salt, salts[i])
+		ensure.True(t, claims.IssuedAt.Equal(issues[i]))
+	}
+	var h header
+	var raw [maxHeaderLen]byte
+	_, _, err = decodeHeader(signer.encoding(), detached, &h, raw[:])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, h.salt, salts[2])
+}
@@ -0,0 +1,67 @@
+package hmacsigner
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidSegments indicates the token was not generated by GenSegments.
+var ErrInvalidSegments = errors.New("hmacsigner: invalid segments")
+
+// Segments are the two parts of a token generated by GenSegments. Neither
+// is encrypted, the names only describe their intended audience.
+type Segments struct {
+	Public  []byte
+	Private []byte
+}
+
+// appendSegment appends seg prefixed with its length to b.
+func appendSegment(b, seg []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	b = append(b, l[:binary.PutUvarint(l[:], uint64(len(seg)))]...)
+	return append(b, seg...)
+}
+
+// readSegment reads a length prefixed segment from b, and returns it along
+// with the rest of b.
+func readSegment(b []byte) ([]byte, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return nil, nil, ErrInvalidSegments
+	}
+	b = b[n:]
+	return b[:l:l], b[l:], nil
+}
+
+// GenSegments returns a signed token carrying both segments under a single
+// signature.
+func (s *Signer) GenSegments(public, private []byte) []byte {
+	payload := make([]byte, 0, len(public)+len(private)+
+		2*binary.MaxVarintLen64)
+	payload = appendSegment(payload, public)
+	payload = appendSegment(payload, private)
+	return genOrNil(s.gen(&header{flags: flagSegments}, nil, payload))
+}
+
+// ParseSegments verifies b like Parse, and returns the segments it carries.
+func (s *Signer) ParseSegments(b []byte) (*Segments, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	if t.header.flags&flagSegments == 0 {
+		return nil, ErrInvalidSegments
+	}
+	public, rest, err := readSegment(t.payload)
+	if err != nil {
+		return nil, err
+	}
+	private, rest, err := readSegment(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidSegments
+	}
+	return &Segments{Public: public, Private: private}, nil
+}
@@ -0,0 +1,64 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestSegments(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	cases := []Segments{
+		{Public: []byte("name"), Private: []byte("role")},
+		{Public: []byte{}, Private: bytes.Repeat([]byte("p"), 300)},
+		{Public: []byte("name"), Private: []byte{}},
+	}
+	for _, c := range cases {
+		actual, err := signer.ParseSegments(signer.GenSegments(c.Public, c.Private))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, actual, &c)
+	}
+}
+
+func TestSegmentsTampered(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.GenSegments([]byte("name"), []byte("role"))
+	h := header{version: versionFlags, flags: flagSegments}
+	payloadStart := base64.RawURLEncoding.EncodedLen(h.signedLen() + sigLen)
+	ensure.DeepEqual(t, string(gen[payloadStart:]), "BG5hbWUEcm9sZQ")
+
+	// Flip a character inside each segment.
+	for _, i := range []int{2, 10} {
+		tampered := append([]byte(nil), gen...)
+		tampered[payloadStart+i] ^= 1
+		_, err := signer.ParseSegments(tampered)
+		ensure.DeepEqual(t, err, ErrSignatureMismatch, i)
+	}
+}
+
+func TestSegmentsInvalid(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	_, err := signer.ParseSegments(signer.Gen([]byte("name")))
+	ensure.DeepEqual(t, err, ErrInvalidSegments)
+
+	for _, payload := range [][]byte{nil, {5, 'a'}, {1, 'a', 1, 'b', 'c'}} {
+		_, err = signer.ParseSegments(genOrNil(signer.gen(
+			&header{flags: flagSegments}, nil, payload)))
+		ensure.DeepEqual(t, err, ErrInvalidSegments, payload)
+	}
+
+	_, err = signer.ParseSegments(nil)
+	ensure.DeepEqual(t, err, ErrTooShort)
+}
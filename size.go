@@ -0,0 +1,121 @@
+package hmacsigner
+
+import "strings"
+
+const (
+	// MaxCookieLen is the commonly supported upper bound for a cookie value.
+	MaxCookieLen = 4096
+
+	// DefaultURLBudget is the URL length considered safe across browsers and
+	// proxies, used by FitsURL when URLBudget is not set.
+	DefaultURLBudget = 2000
+)
+
+// Overhead returns the number of bytes a token generated by Gen adds on top
+// of the encoded payload.
+func (s *Signer) Overhead() int {
+	n := s.encodedHeaderLen()
+	if s.Delimiter != 0 {
+		n++
+	}
+	return n
+}
+
+// encodedHeaderLen returns the length of the encoded header of tokens
+// generated by Gen, including a trailing signature.
+func (s *Signer) encodedHeaderLen() int {
+	return s.encodedHeaderLenWith(0)
+}
+
+// encodedHeaderLenWith is like encodedHeaderLen, with the additional flags.
+func (s *Signer) encodedHeaderLenWith(flags uint16) int {
+	enc := s.encoding()
+	if s.TrailingSig {
+		return enc.EncodedLen(s.headerLen(flags)-sigLen) + enc.EncodedLen(sigLen)
+	}
+	return enc.EncodedLen(s.headerLen(flags))
+}
+
+// headerLen returns the decoded length of the header of tokens generated by
+// Gen with the additional flags.
+func (s *Signer) headerLen(flags uint16) int {
+	h := header{flags: flags}
+	s.setFlags(&h, nil)
+	return h.signedLen() + sigLen
+}
+
+// EncodedLen returns the length of the token Gen produces for a payload of
+// the given length. For a length of 0 it is the length for a nil payload,
+// since an empty one also needs a flag in the header.
+func (s *Signer) EncodedLen(payloadLen int) int {
+	return s.Overhead() + s.encoding().EncodedLen(payloadLen)
+}
+
+// FitsCookie reports if a token for a payload of the given length fits in a
+// cookie value.
+func (s *Signer) FitsCookie(payloadLen int) bool {
+	return s.EncodedLen(payloadLen) <= MaxCookieLen
+}
+
+// FitsURL reports if a token for a payload of the given length fits in the
+// URL budget.
+func (s *Signer) FitsURL(payloadLen int) bool {
+	budget := s.URLBudget
+	if budget == 0 {
+		budget = DefaultURLBudget
+	}
+	return s.EncodedLen(payloadLen) <= budget
+}
+
+// qrByteCapacity and qrAlphanumericCapacity are the number of characters a
+// QR code of each version holds with error correction level M, in byte and
+// alphanumeric mode respectively.
+var (
+	qrByteCapacity = [...]int{
+		14, 26, 42, 62, 84, 106, 122, 152, 180, 213,
+		251, 287, 331, 362, 412, 450, 504, 560, 624, 666,
+		711, 779, 857, 911, 997, 1059, 1125, 1190, 1264, 1370,
+		1452, 1538, 1628, 1722, 1809, 1911, 1989, 2099, 2213, 2331,
+	}
+	qrAlphanumericCapacity = [...]int{
+		20, 38, 61, 90, 122, 154, 178, 221, 262, 311,
+		366, 419, 483, 528, 600, 656, 734, 816, 909, 970,
+		1035, 1134, 1248, 1326, 1451, 1542, 1637, 1732, 1839, 1994,
+		2113, 2238, 2369, 2506, 2632, 2780, 2894, 3054, 3220, 3391,
+	}
+)
+
+// qrAlphanumeric is the character set of the QR alphanumeric mode.
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// FitsQR reports if a token for a payload of the given length fits in a QR
+// code of the given version, from 1 to 40, with error correction level M.
+// Tokens using Base32Encoding, and a Delimiter in the alphanumeric set if
+// any, fit in the denser alphanumeric mode. Others need the byte mode, since
+// base64 includes lower case letters.
+func (s *Signer) FitsQR(payloadLen, version int) bool {
+	if version < 1 || version > len(qrByteCapacity) {
+		return false
+	}
+	capacity := qrByteCapacity[version-1]
+	if s.encoding() == Base32Encoding &&
+		(s.Delimiter == 0 || strings.IndexByte(qrAlphanumeric, s.Delimiter) >= 0) {
+		capacity = qrAlphanumericCapacity[version-1]
+	}
+	return s.EncodedLen(payloadLen) <= capacity
+}
+
+// FixedTokenLen returns the exact length of the token Gen produces for a
+// payload of the given length, and reports if every such token has that
+// length. The header only depends on the configuration, so it does for
+// all lengths except 0, where nil and empty payloads may differ.
+func (s *Signer) FixedTokenLen(payloadLen int) (int, bool) {
+	if payloadLen < 0 {
+		return 0, false
+	}
+	n := s.EncodedLen(payloadLen)
+	if payloadLen == 0 {
+		return n, s.encodedHeaderLenWith(flagEmpty) == s.encodedHeaderLen()
+	}
+	return n, true
+}
@@ -0,0 +1,156 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestEncodedLen(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	ensure.DeepEqual(t, signer.Overhead(), len(signer.Gen(nil)))
+	for _, n := range []int{1, 2, 3, 4, 100, 1000} {
+		gen := signer.Gen(bytes.Repeat([]byte("a"), n))
+		ensure.DeepEqual(t, signer.EncodedLen(n), len(gen), n)
+	}
+}
+
+func TestFitsCookie(t *testing.T) {
+	signer := Signer{}
+	// 4096 - 66 = 4030 encoded bytes, which is 3022 raw bytes plus a partial
+	// group.
+	ensure.True(t, signer.FitsCookie(3022))
+	ensure.DeepEqual(t, signer.EncodedLen(3022), 4096)
+	ensure.False(t, signer.FitsCookie(3023))
+}
+
+func TestFitsURL(t *testing.T) {
+	signer := Signer{}
+	ensure.DeepEqual(t, signer.EncodedLen(1450), 2000)
+	ensure.True(t, signer.FitsURL(1450))
+	ensure.False(t, signer.FitsURL(1451))
+
+	signer.URLBudget = 100
+	ensure.True(t, signer.FitsURL(25))
+	ensure.False(t, signer.FitsURL(26))
+}
+
+func TestFitsQR(t *testing.T) {
+	signer := Signer{}
+	ensure.False(t, signer.FitsQR(0, 4))
+	ensure.DeepEqual(t, signer.EncodedLen(13), 84)
+	ensure.True(t, signer.FitsQR(13, 5))
+	ensure.False(t, signer.FitsQR(14, 5))
+	ensure.True(t, signer.FitsQR(110, 10))
+	ensure.False(t, signer.FitsQR(111, 10))
+	ensure.True(t, signer.FitsQR(1690, 40))
+	ensure.False(t, signer.FitsQR(0, 0))
+	ensure.False(t, signer.FitsQR(0, 41))
+
+	// Base32 uses the alphanumeric mode.
+	signer.Encoding = Base32Encoding
+	ensure.DeepEqual(t, signer.EncodedLen(26), 121)
+	ensure.True(t, signer.FitsQR(26, 5))
+	ensure.False(t, signer.FitsQR(27, 5))
+
+	// Unless the Delimiter is outside of it.
+	signer.Delimiter = '~'
+	ensure.True(t, signer.FitsQR(2, 5))
+	ensure.False(t, signer.FitsQR(3, 5))
+	signer.Delimiter = '.'
+	ensure.True(t, signer.FitsQR(25, 5))
+}
+
+func TestFixedTokenLen(t *testing.T) {
+	configs := []Signer{
+		{},
+		{SchemaVersion: 3},
+		{Audience: "api"},
+		{SchemaVersion: 3, Audience: "api", Encoding: Base32Encoding},
+		{Encoding: base64.StdEncoding},
+	}
+	for i, signer := range configs {
+		signer.Secret = bytes.Repeat([]byte("a"), 32)
+		signer.TTL = time.Hour
+		l, fixed := signer.FixedTokenLen(0)
+		ensure.DeepEqual(t, len(signer.Gen(nil)), l, i)
+		ensure.DeepEqual(t, len(signer.Gen([]byte{})) == l, fixed, i)
+		for _, n := range []int{1, 2, 3, 5, 16, 100} {
+			l, fixed := signer.FixedTokenLen(n)
+			ensure.True(t, fixed, i, n)
+			for j := 0; j < 3; j++ {
+				gen := signer.Gen(bytes.Repeat([]byte{byte(j)}, n))
+				ensure.DeepEqual(t, len(gen), l, i, n)
+			}
+		}
+		ensure.DeepEqual(t, signer.Overhead(), len(signer.Gen(nil)), i)
+	}
+
+	_, fixed := (&Signer{}).FixedTokenLen(-1)
+	ensure.False(t, fixed)
+}
+
+var benchSizes = []int{0, 16, 256, 4 << 10, 64 << 10}
+
+func newBenchSigner() *Signer {
+	return &Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+		nowF:   func() time.Time { return time.Now().Add(-time.Minute) },
+		saltF:  func(b []byte) { copy(b, "saltsalt") },
+	}
+}
+
+func BenchmarkGenSizes(b *testing.B) {
+	signer := newBenchSigner()
+	for _, n := range benchSizes {
+		payload := bytes.Repeat([]byte("a"), n)
+		b.Run(fmt.Sprintf("Gen/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				signer.Gen(payload)
+			}
+		})
+		b.Run(fmt.Sprintf("AppendGen/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(n))
+			buf := make([]byte, 0, signer.EncodedLen(n))
+			for i := 0; i < b.N; i++ {
+				buf = signer.AppendGen(buf[:0], payload)
+			}
+		})
+	}
+}
+
+func BenchmarkParseSizes(b *testing.B) {
+	signer := newBenchSigner()
+	for _, n := range benchSizes {
+		gen := signer.Gen(bytes.Repeat([]byte("a"), n))
+		b.Run(fmt.Sprintf("Parse/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				if _, err := signer.Parse(gen); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("PayloadLen/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				if _, err := signer.PayloadLen(gen); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
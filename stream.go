@@ -0,0 +1,189 @@
+package hmacsigner
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// defaultMaxLineLen is the longest line ParseStream reads when MaxTokenLen is
+// not set.
+const defaultMaxLineLen = 64 * 1024
+
+// ParseStream reads newline delimited tokens from r, and calls fn with the
+// result of parsing each one like Parse, stopping early if it returns false.
+// Empty lines are skipped, and lines longer than MaxTokenLen, or 64KiB if it
+// is not set, are reported as ErrTokenTooLong without being buffered. It
+// returns any error encountered reading r. Its buffer is pooled, so
+// memory use is bounded by the line length, however many lines there are
+// or streams are parsed.
+func (s *Signer) ParseStream(r io.Reader, fn func(payload []byte, err error) bool) error {
+	br := s.getLineReader(r)
+	defer putLineReader(br)
+	for {
+		line, err := readLine(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != ErrTokenTooLong {
+			return err
+		}
+		var payload []byte
+		if err == nil {
+			payload, err = s.Parse(line)
+		}
+		if !fn(payload, err) {
+			return nil
+		}
+	}
+}
+
+// lineReaders holds the readers used by ParseStream.
+var lineReaders sync.Pool
+
+// lineReaderSize returns the buffer size fitting the longest line accepted.
+func (s *Signer) lineReaderSize() int {
+	maxLen := s.MaxTokenLen
+	if maxLen == 0 {
+		maxLen = defaultMaxLineLen
+	}
+	// Leave room for the newline and a carriage return.
+	return maxLen + 2
+}
+
+// newLineReader returns a reader buffering the longest line accepted.
+func (s *Signer) newLineReader(r io.Reader) *bufio.Reader {
+	return bufio.NewReaderSize(r, s.lineReaderSize())
+}
+
+// getLineReader is like newLineReader, but reuses a pooled reader of the
+// same size if there is one.
+func (s *Signer) getLineReader(r io.Reader) *bufio.Reader {
+	if br, ok := lineReaders.Get().(*bufio.Reader); ok {
+		if br.Size() == s.lineReaderSize() {
+			br.Reset(r)
+			return br
+		}
+	}
+	return s.newLineReader(r)
+}
+
+// putLineReader returns br to the pool, without holding on to its reader.
+func putLineReader(br *bufio.Reader) {
+	br.Reset(nil)
+	lineReaders.Put(br)
+}
+
+// readLine returns the next non empty line from br, without the line ending.
+// It is only valid until the next read. Lines which do not fit in the buffer
+// are skipped and reported as ErrTokenTooLong, and io.EOF is returned once
+// there are no more lines.
+func readLine(br *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if err = skipLine(br); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, ErrTokenTooLong
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+	}
+}
+
+// skipLine discards the rest of the current line.
+func skipLine(br *bufio.Reader) error {
+	for {
+		_, err := br.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// lineBufs holds the buffers used by Encoders and GenTo.
+var lineBufs = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// Encoder writes newline delimited tokens, as read by Decoder and
+// ParseStream.
+type Encoder struct {
+	s *Signer
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder writing tokens generated by the Signer to w.
+func (s *Signer) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{s: s, w: w}
+}
+
+// Encode writes a token for the payload followed by a newline, using a single
+// Write.
+func (e *Encoder) Encode(payload []byte) error {
+	buf := lineBufs.Get().(*[]byte)
+	defer lineBufs.Put(buf)
+	line, err := e.s.appendGen((*buf)[:0], &header{}, nil, payload)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	*buf = line
+	_, err = e.w.Write(line)
+	return err
+}
+
+// GenTo writes a token for the payload to w using a single Write, such as to
+// a strings.Builder or a template, without allocating it. It returns the
+// number of bytes written, and io.ErrShortWrite if w wrote less than the
+// token without an error. It is not named WriteTo, since that name is
+// reserved for io.WriterTo.
+func (s *Signer) GenTo(w io.Writer, payload []byte) (int, error) {
+	buf := lineBufs.Get().(*[]byte)
+	defer lineBufs.Put(buf)
+	gen, err := s.appendGen((*buf)[:0], &header{}, nil, payload)
+	if err != nil {
+		return 0, err
+	}
+	*buf = gen
+	n, err := w.Write(gen)
+	if err == nil && n < len(gen) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// Decoder reads newline delimited tokens, such as those written by Encoder,
+// and verifies them one at a time.
+type Decoder struct {
+	s  *Signer
+	br *bufio.Reader
+}
+
+// NewDecoder returns a Decoder verifying the tokens read from r with the
+// Signer. Lines are limited to MaxTokenLen like ParseStream.
+func (s *Signer) NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{s: s, br: s.newLineReader(r)}
+}
+
+// Decode verifies the next token like Parse, and returns its payload. A
+// rejected token does not stop the Decoder, and the next call continues with
+// the following one. It returns io.EOF once there are no more tokens, and any
+// error encountered reading.
+func (d *Decoder) Decode() ([]byte, error) {
+	line, err := readLine(d.br)
+	if err != nil {
+		return nil, err
+	}
+	return d.s.Parse(line)
+}
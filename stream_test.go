@@ -0,0 +1,190 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+type streamResult struct {
+	Payload string
+	Err     error
+}
+
+func TestParseStream(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		MaxTokenLen: 200,
+	}
+	other := Signer{Secret: bytes.Repeat([]byte("b"), 32)}
+	input := strings.Join([]string{
+		string(signer.Gen([]byte("one"))),
+		"garbage",
+		"",
+		string(other.Gen([]byte("forged"))),
+		strings.Repeat("a", 500),
+		string(signer.Gen([]byte("two"))) + "\r",
+		string(signer.Gen([]byte("three"))),
+	}, "\n")
+
+	var results []streamResult
+	err := signer.ParseStream(strings.NewReader(input),
+		func(payload []byte, err error) bool {
+			results = append(results, streamResult{string(payload), err})
+			return true
+		})
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, results, []streamResult{
+		{Payload: "one"},
+		{Err: ErrTooShort},
+		{Err: ErrSignatureMismatch},
+		{Err: ErrTokenTooLong},
+		{Payload: "two"},
+		{Payload: "three"},
+	})
+
+	results = nil
+	err = signer.ParseStream(strings.NewReader(input),
+		func(payload []byte, err error) bool {
+			results = append(results, streamResult{string(payload), err})
+			return err == nil
+		})
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(results), 2)
+
+	err = signer.ParseStream(errReader{},
+		func([]byte, error) bool { return true })
+	ensure.DeepEqual(t, err.Error(), "read failed")
+}
+
+func TestParseStreamPooled(t *testing.T) {
+	signer := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	input := append(signer.Gen([]byte("a@b.c")), '\n')
+	parse := func() {
+		ensure.Nil(t, signer.ParseStream(bytes.NewReader(input),
+			func([]byte, error) bool { return true }))
+	}
+	parse()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	const runs = 100
+	for i := 0; i < runs; i++ {
+		parse()
+	}
+	runtime.ReadMemStats(&after)
+	// Allocating the buffer every time would be runs times defaultMaxLineLen.
+	// The race detector drops some pooled items, so allow for a few.
+	allocated := after.TotalAlloc - before.TotalAlloc
+	ensure.True(t, allocated < runs*defaultMaxLineLen/2, allocated)
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		MaxTokenLen: 200,
+	}
+	var buf bytes.Buffer
+	enc := signer.NewEncoder(&buf)
+	ensure.Nil(t, enc.Encode([]byte("one")))
+	ensure.Nil(t, enc.Encode([]byte("two")))
+	// Corrupt the signature of the second record.
+	if c := &buf.Bytes()[buf.Len()-10]; *c == 'A' {
+		*c = 'B'
+	} else {
+		*c = 'A'
+	}
+	ensure.Nil(t, enc.Encode(nil))
+	buf.WriteString(strings.Repeat("a", 500) + "\n")
+	ensure.Nil(t, enc.Encode([]byte("four")))
+
+	var results []streamResult
+	dec := signer.NewDecoder(&buf)
+	for {
+		payload, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		results = append(results, streamResult{string(payload), err})
+	}
+	ensure.DeepEqual(t, results, []streamResult{
+		{Payload: "one"},
+		{Err: ErrSignatureMismatch},
+		{},
+		{Err: ErrTokenTooLong},
+		{Payload: "four"},
+	})
+
+	_, err := signer.NewDecoder(errReader{}).Decode()
+	ensure.DeepEqual(t, err.Error(), "read failed")
+}
+
+type shortWriter struct{ n int }
+
+func (w shortWriter) Write(b []byte) (int, error) {
+	return w.n, nil
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestGenTo(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	var sb strings.Builder
+	n, err := signer.GenTo(&sb, []byte("a@b.c"))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, n, sb.Len())
+	ensure.DeepEqual(t, n, signer.EncodedLen(5))
+	payload, err := signer.Parse([]byte(sb.String()))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	n, err = signer.GenTo(shortWriter{n: 10}, []byte("a@b.c"))
+	ensure.DeepEqual(t, err, io.ErrShortWrite)
+	ensure.DeepEqual(t, n, 10)
+	_, err = signer.GenTo(errWriter{}, []byte("a@b.c"))
+	ensure.DeepEqual(t, err.Error(), "write failed")
+
+	signer.VerifyOnly = true
+	defer func(v bool) { PanicOnMisconfig = v }(PanicOnMisconfig)
+	PanicOnMisconfig = false
+	_, err = signer.GenTo(&sb, nil)
+	ensure.DeepEqual(t, err, ErrGenDisabled)
+}
+
+func BenchmarkGenTo(b *testing.B) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	payload := []byte("a@b.c")
+	b.Run("GenTo", func(b *testing.B) {
+		b.ReportAllocs()
+		var sb strings.Builder
+		for i := 0; i < b.N; i++ {
+			sb.Reset()
+			signer.GenTo(&sb, payload)
+		}
+	})
+	b.Run("WriteString", func(b *testing.B) {
+		b.ReportAllocs()
+		var sb strings.Builder
+		for i := 0; i < b.N; i++ {
+			sb.Reset()
+			sb.WriteString(string(signer.Gen(payload)))
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// stretchIterations is the PBKDF2 iteration count used by StretchSecret.
+const stretchIterations = 100000
+
+// stretchSalt is the fixed PBKDF2 salt used by StretchSecret. It is fixed
+// since the key must be reproducible from the secret alone.
+var stretchSalt = []byte("hmacsigner stretch v1")
+
+// stretched is a secret along with the key derived from it.
+type stretched struct {
+	secret []byte
+	key    []byte
+}
+
+// key returns the HMAC key for the secret, which is the secret itself unless
+// StretchSecret, Pepper or BootID are set.
+func (s *Signer) key(secret []byte) []byte {
+	if s.StretchSecret {
+		secret = s.stretch(secret)
+	}
+	if len(s.Pepper) != 0 {
+		mac := hmac.New(sha256.New, s.Pepper)
+		mac.Write([]byte("hmacsigner pepper "))
+		mac.Write(secret)
+		secret = mac.Sum(nil)
+	}
+	if len(s.BootID) != 0 {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("hmacsigner boot "))
+		mac.Write(s.BootID)
+		secret = mac.Sum(nil)
+	}
+	return secret
+}
+
+// stretch returns the key derived from the secret using PBKDF2. The keys of
+// the configured secrets are cached, and derived once per secret. Secrets
+// missing from the cache cause it to be rebuilt from the configured secrets
+// rather than being stretched themselves, so a KeyID picked by a forger can
+// only select among the configured secrets.
+func (s *Signer) stretch(secret []byte) []byte {
+	if key := s.stretchedKey(secret); key != nil {
+		return key
+	}
+	s.restretch()
+	if key := s.stretchedKey(secret); key != nil {
+		return key
+	}
+	// Not a configured secret, such as one changed since tokens were
+	// generated. It is stretched on every use.
+	return pbkdf2(secret, stretchSalt, stretchIterations)
+}
+
+// stretchedKey returns the cached key for the secret, or nil.
+func (s *Signer) stretchedKey(secret []byte) []byte {
+	cache, _ := s.stretched.Load().([]stretched)
+	for _, c := range cache {
+		if bytes.Equal(c.secret, secret) {
+			return c.key
+		}
+	}
+	return nil
+}
+
+// restretch rebuilds the cache from the configured secrets, including all
+// those returned by ResolveSecret, reusing the keys already derived.
+func (s *Signer) restretch() {
+	var secrets [][]byte
+	if raw, err := s.rawSecrets(); err == nil {
+		secrets = append(secrets, raw...)
+	}
+	if s.ResolveSecret != nil {
+		for id := 0; id <= 0xff; id++ {
+			if secret, err := s.ResolveSecret(byte(id)); err == nil {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	var next []stretched
+	for _, secret := range secrets {
+		if len(secret) < minSecretLen {
+			continue
+		}
+		seen := false
+		for _, c := range next {
+			if bytes.Equal(c.secret, secret) {
+				seen = true
+				break
+			}
+		}
+		if seen {
+			continue
+		}
+		key := s.stretchedKey(secret)
+		if key == nil {
+			key = pbkdf2(secret, stretchSalt, stretchIterations)
+		}
+		next = append(next, stretched{
+			secret: append([]byte(nil), secret...),
+			key:    key,
+		})
+	}
+	s.stretched.Store(next)
+}
+
+// pbkdf2 derives a single block PBKDF2-HMAC-SHA256 key as defined in RFC
+// 8018.
+func pbkdf2(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	var block [4]byte
+	binary.BigEndian.PutUint32(block[:], 1)
+	mac.Write(block[:])
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
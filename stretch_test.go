@@ -0,0 +1,80 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Generated using Python's hashlib.pbkdf2_hmac("sha256", ...).
+	ensure.DeepEqual(t,
+		hex.EncodeToString(pbkdf2([]byte("password"), []byte("salt"), 4096)),
+		"c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a")
+	ensure.DeepEqual(t,
+		hex.EncodeToString(pbkdf2(bytes.Repeat([]byte("a"), 32), stretchSalt,
+			stretchIterations)),
+		"5617da6352cdd33003286183dddd0a3f23848969e50951f11378548925459d61")
+}
+
+func TestStretchSecret(t *testing.T) {
+	plain := Signer{Secret: bytes.Repeat([]byte("a"), 32), TTL: time.Hour}
+	stretched := plain
+	stretched.StretchSecret = true
+
+	token := stretched.Gen([]byte("payload"))
+	payload, err := stretched.Parse(token)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(payload), "payload")
+
+	_, err = plain.Parse(token)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, err = stretched.Parse(plain.Gen([]byte("payload")))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
+
+func TestStretchSecretCache(t *testing.T) {
+	secrets := make([][]byte, 6)
+	for i := range secrets {
+		secrets[i] = bytes.Repeat([]byte{byte(i)}, 32)
+	}
+	signer := Signer{
+		TTL:           time.Hour,
+		StretchSecret: true,
+		ResolveSecret: func(keyID byte) ([]byte, error) {
+			if int(keyID) >= len(secrets) {
+				return nil, ErrWrongSecret
+			}
+			return secrets[keyID], nil
+		},
+	}
+	tokens := make([][]byte, len(secrets))
+	for i := range secrets {
+		gen := Signer{
+			Secret:        secrets[i],
+			TTL:           time.Hour,
+			StretchSecret: true,
+			KeyID:         byte(i),
+		}
+		tokens[i] = gen.Gen([]byte("payload"))
+	}
+
+	_, err := signer.Parse(tokens[0])
+	ensure.Nil(t, err)
+	cache := signer.stretched.Load().([]stretched)
+	ensure.DeepEqual(t, len(cache), len(secrets))
+
+	// Every configured secret was stretched up front, so cycling through
+	// the KeyIDs never rebuilds the cache.
+	for n := 0; n < 2; n++ {
+		for _, token := range tokens {
+			_, err := signer.Parse(token)
+			ensure.Nil(t, err)
+		}
+	}
+	after := signer.stretched.Load().([]stretched)
+	ensure.True(t, &after[0] == &cache[0])
+}
@@ -0,0 +1,56 @@
+package hmacsigner
+
+import "io"
+
+// Token is an encoded token along with the Signer for it. It implements
+// io.WriterTo and io.ReaderFrom, so it can be copied to and from network
+// connections and buffered readers and writers directly.
+type Token struct {
+	Signer *Signer
+
+	// Bytes is the encoded token.
+	Bytes []byte
+
+	// Payload is the verified payload, set by ReadFrom.
+	Payload []byte
+}
+
+// WriteTo writes the encoded token to w.
+func (t *Token) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(t.Bytes)
+	return int64(n), err
+}
+
+// ReadFrom reads a single token generated with EmbedLength from r like
+// ParseReader, and sets Bytes and Payload once it has been verified. Unlike
+// other implementations of io.ReaderFrom it stops at the end of the token,
+// and since a token is expected it returns io.ErrUnexpectedEOF if r is empty.
+func (t *Token) ReadFrom(r io.Reader) (int64, error) {
+	cr := countingReader{r: r}
+	b, err := t.Signer.readToken(&cr)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return cr.n, err
+	}
+	payload, err := t.Signer.Parse(b)
+	if err != nil {
+		return cr.n, err
+	}
+	t.Bytes = b
+	t.Payload = payload
+	return cr.n, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,61 @@
+package hmacsigner
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestToken(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		EmbedLength: true,
+	}
+	var _ io.WriterTo = &Token{}
+	var _ io.ReaderFrom = &Token{}
+
+	var buf bytes.Buffer
+	payloads := [][]byte{[]byte("a@b.c"), []byte("d@e.f")}
+	for _, payload := range payloads {
+		token := Token{Signer: &signer, Bytes: signer.Gen(payload)}
+		n, err := token.WriteTo(&buf)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, int(n), len(token.Bytes))
+	}
+
+	br := bufio.NewReader(&buf)
+	for _, payload := range payloads {
+		token := Token{Signer: &signer}
+		n, err := token.ReadFrom(br)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, int(n), len(token.Bytes))
+		ensure.DeepEqual(t, token.Payload, payload)
+	}
+	token := Token{Signer: &signer}
+	_, err := token.ReadFrom(br)
+	ensure.DeepEqual(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestTokenShortRead(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		EmbedLength: true,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	token := Token{Signer: &signer}
+	n, err := token.ReadFrom(bytes.NewReader(gen[:len(gen)-2]))
+	ensure.DeepEqual(t, err, io.ErrUnexpectedEOF)
+	ensure.DeepEqual(t, int(n), len(gen)-2)
+	ensure.True(t, token.Bytes == nil)
+
+	forged := Signer{Secret: bytes.Repeat([]byte("b"), 32), EmbedLength: true}
+	_, err = token.ReadFrom(bytes.NewReader(forged.Gen([]byte("a@b.c"))))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	ensure.True(t, token.Payload == nil)
+}
@@ -0,0 +1,34 @@
+package hmacsigner
+
+import "time"
+
+// tombstoneAAD marks tombstones, so they are not accepted as tokens, nor the
+// other way around.
+var tombstoneAAD = []aadPart{{"tombstone", nil}}
+
+// Tombstone verifies b like Parse, and returns a signed record of its
+// revocation containing its salt and the current time. Other nodes using the
+// same secret can verify it with ParseTombstone for the TTL, which covers the
+// remaining lifetime of the revoked token.
+func (s *Signer) Tombstone(b []byte) ([]byte, error) {
+	var t token
+	if err := s.verify(b, &t); err != nil {
+		return nil, err
+	}
+	return s.gen(&header{}, tombstoneAAD, t.header.salt[:])
+}
+
+// ParseTombstone verifies a tombstone generated by Tombstone, and returns the
+// salt of the revoked token along with the time it was revoked.
+func (s *Signer) ParseTombstone(b []byte) ([saltLen]byte, time.Time, error) {
+	var salt [saltLen]byte
+	t := token{aad: tombstoneAAD}
+	if err := s.verify(b, &t); err != nil {
+		return salt, time.Time{}, err
+	}
+	if len(t.payload) != saltLen {
+		return salt, time.Time{}, ErrInvalidEncoding
+	}
+	copy(salt[:], t.payload)
+	return salt, s.time(t.header.issue), nil
+}
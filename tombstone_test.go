@@ -0,0 +1,50 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestTombstone(t *testing.T) {
+	signer := Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	claims, err := signer.ParseFull(gen)
+	ensure.Nil(t, err)
+
+	before := time.Now()
+	tombstone, err := signer.Tombstone(gen)
+	ensure.Nil(t, err)
+	salt, revoked, err := signer.ParseTombstone(tombstone)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, salt, claims.Salt)
+	ensure.False(t, revoked.Before(before))
+	ensure.False(t, revoked.After(time.Now()))
+
+	// Tombstones and tokens are not interchangeable.
+	_, err = signer.Parse(tombstone)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	_, _, err = signer.ParseTombstone(gen)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	tampered := append([]byte(nil), tombstone...)
+	if c := &tampered[len(tampered)-5]; *c == 'A' {
+		*c = 'B'
+	} else {
+		*c = 'A'
+	}
+	_, _, err = signer.ParseTombstone(tampered)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	other := Signer{Secret: bytes.Repeat([]byte("b"), 32), TTL: time.Hour}
+	_, _, err = other.ParseTombstone(tombstone)
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+
+	_, err = signer.Tombstone(other.Gen(nil))
+	ensure.DeepEqual(t, err, ErrSignatureMismatch)
+}
@@ -0,0 +1,47 @@
+package hmacsigner
+
+// decodeTrailingSig decodes the signature at the end of b, which follows the
+// payload of version 3 tokens, into sig. It returns the encoded payload.
+func decodeTrailingSig(enc Encoding, b, sig []byte) ([]byte, error) {
+	encLen := enc.EncodedLen(sigLen)
+	if len(b) < encLen {
+		return nil, ErrTooShort
+	}
+	n, err := enc.Decode(sig, b[len(b)-encLen:])
+	if err != nil || n != sigLen {
+		return nil, ErrInvalidEncoding
+	}
+	return b[:len(b)-encLen], nil
+}
+
+// appendToken appends the encoded token with the header raw, whose signature
+// follows the first n bytes, and the payload to dst.
+func (s *Signer) appendToken(dst []byte, h *header, raw []byte, n int, payload []byte) []byte {
+	head, trailer := raw[:n+sigLen], raw[:0]
+	if h.version == versionTrailing {
+		head, trailer = raw[:n], raw[n:n+sigLen]
+	}
+
+	enc := s.encoding()
+	encLen := enc.EncodedLen(len(head))
+	payloadStart := encLen
+	if s.Delimiter != 0 {
+		payloadStart++
+	}
+	payloadEnd := payloadStart + enc.EncodedLen(len(payload))
+	tokenLen := payloadEnd + enc.EncodedLen(len(trailer))
+	start := len(dst)
+	if cap(dst)-start < tokenLen {
+		grown := make([]byte, start, start+tokenLen)
+		copy(grown, dst)
+		dst = grown
+	}
+	blob := dst[start : start+tokenLen]
+	enc.Encode(blob, head)
+	if s.Delimiter != 0 {
+		blob[encLen] = s.Delimiter
+	}
+	enc.Encode(blob[payloadStart:], payload)
+	enc.Encode(blob[payloadEnd:], trailer)
+	return dst[:start+tokenLen]
+}
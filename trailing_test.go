@@ -0,0 +1,152 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestTrailingSig(t *testing.T) {
+	cases := []Signer{
+		{},
+		{Delimiter: '.'},
+		{Encoding: base64.StdEncoding},
+		{Encoding: Base32Encoding},
+		{Audience: "api", EmbedLength: true},
+	}
+	payloads := [][]byte{
+		[]byte("a@b.c"),
+		nil,
+		{},
+		bytes.Repeat([]byte("x"), 1000),
+	}
+	for _, signer := range cases {
+		signer.Secret = bytes.Repeat([]byte("a"), 32)
+		signer.TTL = time.Hour
+		signer.TrailingSig = true
+		verifier := signer
+		verifier.TrailingSig = false
+
+		for _, payload := range payloads {
+			gen := signer.Gen(payload)
+			ensure.DeepEqual(t, len(gen), signer.EncodedLen(len(payload)))
+			for _, s := range []*Signer{&signer, &verifier} {
+				parsed, err := s.Parse(gen)
+				ensure.Nil(t, err)
+				ensure.DeepEqual(t, parsed, payload)
+				n, err := s.PayloadLen(gen)
+				ensure.Nil(t, err)
+				ensure.DeepEqual(t, n, len(payload))
+			}
+
+			// The signature is at the end, so any change to it or the payload
+			// is detected.
+			tampered := append([]byte(nil), gen...)
+			if c := &tampered[len(tampered)-8]; *c == 'A' {
+				*c = 'B'
+			} else {
+				*c = 'A'
+			}
+			_, err := signer.Parse(tampered)
+			ensure.NotNil(t, err)
+		}
+
+		aad := signer.GenAAD([]byte("a@b.c"), []byte("ctx"))
+		parsed, err := signer.ParseAAD(aad, []byte("ctx"))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, parsed, []byte("a@b.c"))
+		_, err = signer.ParseAAD(aad, []byte("other"))
+		ensure.DeepEqual(t, err, ErrSignatureMismatch)
+	}
+}
+
+func TestTrailingSigLayout(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		TrailingSig: true,
+		Delimiter:   '.',
+	}
+	gen := signer.Gen([]byte("a@b.c"))
+	parts := strings.Split(string(gen), ".")
+	ensure.DeepEqual(t, len(parts), 2)
+	enc := base64.RawURLEncoding
+	raw, err := enc.DecodeString(parts[0])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, raw[0], versionTrailing)
+	sigStart := len(parts[1]) - enc.EncodedLen(sigLen)
+	payload, err := enc.DecodeString(parts[1][:sigStart])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, payload, []byte("a@b.c"))
+
+	parsed, err := signer.ParseEncodedParts(parts[0], parts[1])
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, parsed, []byte("a@b.c"))
+
+	signer.MaxVersion = versionFlags
+	_, err = signer.Parse(gen)
+	ensure.DeepEqual(t, err, ErrInvalidVersion)
+}
+
+func TestTrailingSigStreams(t *testing.T) {
+	signer := Signer{
+		Secret:      bytes.Repeat([]byte("a"), 32),
+		TTL:         time.Hour,
+		TrailingSig: true,
+	}
+	payloads := [][]byte{[]byte("a@b.c"), {}, []byte("d@e.f")}
+
+	var lines bytes.Buffer
+	encoder := signer.NewEncoder(&lines)
+	for _, payload := range payloads {
+		ensure.Nil(t, encoder.Encode(payload))
+	}
+	decoder := signer.NewDecoder(&lines)
+	for _, payload := range payloads {
+		parsed, err := decoder.Decode()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, parsed, payload)
+	}
+	_, err := decoder.Decode()
+	ensure.DeepEqual(t, err, io.EOF)
+
+	signer.EmbedLength = true
+	var stream bytes.Buffer
+	for _, payload := range payloads {
+		stream.Write(signer.Gen(payload))
+	}
+	for _, payload := range payloads {
+		parsed, err := signer.ParseReader(&stream)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, parsed, payload)
+	}
+	_, err = signer.ParseReader(&stream)
+	ensure.DeepEqual(t, err, io.EOF)
+}
+
+func TestTrailingSigDetached(t *testing.T) {
+	for _, delimiter := range []byte{0, '.'} {
+		signer := Signer{
+			Secret:      bytes.Repeat([]byte("a"), 32),
+			TTL:         time.Hour,
+			TrailingSig: true,
+			Delimiter:   delimiter,
+		}
+		payload := []byte("a@b.c")
+		detached := signer.GenDetached(payload)
+		ensure.Nil(t, signer.VerifyDetachedReader(detached, bytes.NewReader(payload)))
+		ensure.DeepEqual(t,
+			signer.VerifyDetachedReader(detached, bytes.NewReader([]byte("x"))),
+			ErrSignatureMismatch)
+
+		streamed, err := signer.GenDetachedReader(bytes.NewReader(payload))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, len(streamed), len(detached))
+		ensure.Nil(t, signer.VerifyDetachedReader(streamed, bytes.NewReader(payload)))
+	}
+}
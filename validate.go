@@ -0,0 +1,174 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidTTL indicates the TTL is not positive.
+	ErrInvalidTTL = errors.New("hmacsigner: ttl must be positive")
+
+	// ErrLeewayExceedsTTL indicates the leeway past the expiry is not less
+	// than the TTL.
+	ErrLeewayExceedsTTL = errors.New("hmacsigner: leeway exceeds ttl")
+)
+
+// Validate checks the configuration of the Signer, returning the first
+// problem found. Call it at startup to fail fast. A verifier with a
+// ResolveSecret needs no Secret nor SecretProvider.
+func (s *Signer) Validate() error {
+	if err := s.validateSecrets(); err != nil {
+		return err
+	}
+	if s.TTL <= 0 {
+		return ErrInvalidTTL
+	}
+	if s.MinAcceptedTTL < 0 || s.MinAcceptedTTL > s.TTL {
+		return errors.New("hmacsigner: min accepted ttl must be between 0 and the ttl")
+	}
+	if s.PreviousTTL < 0 {
+		return errors.New("hmacsigner: previous ttl must not be negative")
+	}
+	if s.Leeway < 0 || s.PastLeeway < 0 || s.FutureLeeway < 0 {
+		return errors.New("hmacsigner: leeway must not be negative")
+	}
+	if leeway := s.pastLeeway(); leeway > 0 && leeway >= s.TTL {
+		return ErrLeewayExceedsTTL
+	}
+	if s.KeyPeriod < 0 || (s.KeyPeriod > 0 && s.acceptedTTL()+s.pastLeeway() > s.KeyPeriod) {
+		return errors.New("hmacsigner: key period must cover the ttl and leeway")
+	}
+	if s.MaxVersion != 0 && s.MinVersion > s.MaxVersion {
+		return errors.New("hmacsigner: min version exceeds max version")
+	}
+	if s.NearExpiry < 0 {
+		return errors.New("hmacsigner: near expiry must not be negative")
+	}
+	if err := checkEncoding(s.encoding()); err != nil {
+		return err
+	}
+	for _, enc := range s.LegacyEncodings {
+		if err := checkEncoding(enc); err != nil {
+			return err
+		}
+	}
+	if s.Delimiter != 0 {
+		probe := bytes.Repeat([]byte{s.Delimiter}, 8)
+		decoded := make([]byte, s.encoding().DecodedLen(len(probe)))
+		if _, err := s.encoding().Decode(decoded, probe); err == nil {
+			return errors.New("hmacsigner: delimiter is part of the encoding")
+		}
+	}
+	if s.MaxTokenLen < 0 || (s.MaxTokenLen > 0 && s.MaxTokenLen < s.Overhead()) {
+		return fmt.Errorf("hmacsigner: max token length must be at least %v",
+			s.Overhead())
+	}
+	if s.URLBudget < 0 {
+		return errors.New("hmacsigner: url budget must not be negative")
+	}
+	return nil
+}
+
+// validateSecrets ensures the configured secrets are long enough.
+func (s *Signer) validateSecrets() error {
+	if s.ResolveSecret != nil && s.Secret == nil && s.SecretProvider == nil {
+		return nil
+	}
+	secrets, err := s.rawSecrets()
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		return ErrSecretTooShort
+	}
+	for _, secret := range secrets {
+		if len(secret) < minSecretLen {
+			return ErrSecretTooShort
+		}
+	}
+	return nil
+}
+
+// checkEncoding ensures enc decodes what it encodes.
+func checkEncoding(enc Encoding) error {
+	if enc == nil {
+		return errors.New("hmacsigner: nil legacy encoding")
+	}
+	var sample [maxHeaderLen]byte
+	for i := range sample {
+		sample[i] = byte(i * 7)
+	}
+	encoded := make([]byte, enc.EncodedLen(len(sample)))
+	enc.Encode(encoded, sample[:])
+	decoded := make([]byte, enc.DecodedLen(len(encoded)))
+	n, err := enc.Decode(decoded, encoded)
+	if err != nil || !bytes.Equal(decoded[:n], sample[:]) {
+		return errors.New("hmacsigner: encoding does not round trip")
+	}
+	return nil
+}
+
+// Compatible reports whether tokens generated by a are accepted by b,
+// returning a description of the first incompatibility found. Call it with
+// the arguments swapped to also check the other direction. The hash, salt
+// and signature lengths are fixed by FormatSpec, so the format only depends
+// on the options checked here. The signing key of a, including any
+// stretching, Pepper and BootID, must be one of the keys of b. They are
+// compared in full, which is stronger than comparing Fingerprints.
+func Compatible(a, b *Signer) error {
+	accepted := a.encoding() == b.encoding()
+	for _, enc := range b.LegacyEncodings {
+		accepted = accepted || a.encoding() == enc
+	}
+	if !accepted {
+		return fmt.Errorf("hmacsigner: encoding %v is not accepted",
+			encodingName(a.encoding()))
+	}
+	if a.Delimiter != b.Delimiter {
+		return fmt.Errorf("hmacsigner: delimiter %q does not match %q",
+			a.Delimiter, b.Delimiter)
+	}
+	var h header
+	a.setFlags(&h, nil)
+	if err := b.checkVersion(&h); err != nil {
+		return fmt.Errorf("hmacsigner: version %v is not accepted", h.version)
+	}
+	if !a.Epoch.Equal(b.Epoch) {
+		return errors.New("hmacsigner: epoch does not match")
+	}
+	if a.KeyPeriod != b.KeyPeriod {
+		return errors.New("hmacsigner: key period does not match")
+	}
+	if a.Audience != b.Audience {
+		return fmt.Errorf("hmacsigner: audience %q does not match %q",
+			a.Audience, b.Audience)
+	}
+	if a.Generation < b.MinGeneration {
+		return fmt.Errorf("hmacsigner: generation %v is below %v",
+			a.Generation, b.MinGeneration)
+	}
+	if b.AllowedIssuers != nil && bytes.IndexByte(b.AllowedIssuers, a.Issuer) < 0 {
+		return fmt.Errorf("hmacsigner: issuer %v is not allowed", a.Issuer)
+	}
+
+	keys, err := a.keys(nil)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrSecretTooShort
+	}
+	accepting, err := b.keys(nil)
+	if err != nil {
+		return err
+	}
+	for _, key := range accepting {
+		if hmac.Equal(key, keys[0]) {
+			return nil
+		}
+	}
+	return ErrWrongSecret
+}
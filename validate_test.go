@@ -0,0 +1,232 @@
+package hmacsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func validSigner() Signer {
+	return Signer{
+		Secret: bytes.Repeat([]byte("a"), 32),
+		TTL:    time.Hour,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	signer := validSigner()
+	ensure.Nil(t, signer.Validate())
+
+	signer.Leeway = time.Minute
+	signer.Encoding = base64.StdEncoding
+	signer.LegacyEncodings = []Encoding{base64.RawURLEncoding, Base32Encoding}
+	signer.MaxTokenLen = 100
+	signer.NearExpiry = time.Minute
+	signer.Delimiter = '.'
+	ensure.Nil(t, signer.Validate())
+}
+
+func TestValidateLeeway(t *testing.T) {
+	cases := []struct {
+		TTL          time.Duration
+		Leeway       time.Duration
+		PastLeeway   time.Duration
+		FutureLeeway time.Duration
+		Err          error
+	}{
+		{TTL: time.Hour},
+		{TTL: time.Hour, Leeway: time.Minute},
+		{TTL: time.Hour, Leeway: time.Hour - 1},
+		{TTL: time.Hour, Leeway: time.Hour, Err: ErrLeewayExceedsTTL},
+		{TTL: time.Minute, Leeway: time.Hour, Err: ErrLeewayExceedsTTL},
+		{TTL: time.Hour, PastLeeway: time.Hour, Err: ErrLeewayExceedsTTL},
+		{TTL: time.Hour, Leeway: time.Hour, PastLeeway: time.Minute},
+		{TTL: time.Hour, FutureLeeway: 2 * time.Hour},
+	}
+	for _, c := range cases {
+		signer := validSigner()
+		signer.TTL = c.TTL
+		signer.Leeway = c.Leeway
+		signer.PastLeeway = c.PastLeeway
+		signer.FutureLeeway = c.FutureLeeway
+		ensure.DeepEqual(t, signer.Validate(), c.Err, c)
+	}
+}
+
+type brokenEncoding struct {
+	*base64.Encoding
+}
+
+func (brokenEncoding) Decode(dst, src []byte) (int, error) {
+	return 0, nil
+}
+
+func TestValidateErrors(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Signer func(s *Signer)
+		Err    string
+	}{
+		{
+			Name:   "short secret",
+			Signer: func(s *Signer) { s.Secret = s.Secret[:31] },
+			Err:    "secret too short",
+		},
+		{
+			Name:   "zero ttl",
+			Signer: func(s *Signer) { s.TTL = 0 },
+			Err:    "ttl must be positive",
+		},
+		{
+			Name:   "negative ttl",
+			Signer: func(s *Signer) { s.TTL = -time.Hour },
+			Err:    "ttl must be positive",
+		},
+		{
+			Name:   "negative leeway",
+			Signer: func(s *Signer) { s.Leeway = -time.Minute },
+			Err:    "leeway must not be negative",
+		},
+		{
+			Name:   "key period shorter than ttl",
+			Signer: func(s *Signer) { s.KeyPeriod = time.Minute },
+			Err:    "key period must cover the ttl and leeway",
+		},
+		{
+			Name: "inverted version range",
+			Signer: func(s *Signer) {
+				s.MinVersion = 2
+				s.MaxVersion = 1
+			},
+			Err: "min version exceeds max version",
+		},
+		{
+			Name:   "negative near expiry",
+			Signer: func(s *Signer) { s.NearExpiry = -time.Minute },
+			Err:    "near expiry must not be negative",
+		},
+		{
+			Name: "broken encoding",
+			Signer: func(s *Signer) {
+				s.Encoding = brokenEncoding{base64.RawURLEncoding}
+			},
+			Err: "encoding does not round trip",
+		},
+		{
+			Name: "broken legacy encoding",
+			Signer: func(s *Signer) {
+				s.LegacyEncodings = []Encoding{brokenEncoding{base64.StdEncoding}}
+			},
+			Err: "encoding does not round trip",
+		},
+		{
+			Name:   "nil legacy encoding",
+			Signer: func(s *Signer) { s.LegacyEncodings = []Encoding{nil} },
+			Err:    "nil legacy encoding",
+		},
+		{
+			Name:   "max token len below overhead",
+			Signer: func(s *Signer) { s.MaxTokenLen = 10 },
+			Err:    "max token length must be at least 66",
+		},
+		{
+			Name:   "negative max token len",
+			Signer: func(s *Signer) { s.MaxTokenLen = -1 },
+			Err:    "max token length must be at least 66",
+		},
+		{
+			Name:   "delimiter in alphabet",
+			Signer: func(s *Signer) { s.Delimiter = 'A' },
+			Err:    "delimiter is part of the encoding",
+		},
+		{
+			Name: "delimiter in base32 alphabet",
+			Signer: func(s *Signer) {
+				s.Encoding = Base32Encoding
+				s.Delimiter = 'a'
+			},
+			Err: "delimiter is part of the encoding",
+		},
+		{
+			Name:   "negative url budget",
+			Signer: func(s *Signer) { s.URLBudget = -1 },
+			Err:    "url budget must not be negative",
+		},
+	}
+	for _, c := range cases {
+		signer := validSigner()
+		c.Signer(&signer)
+		ensure.Err(t, signer.Validate(), regexp.MustCompile(c.Err), c.Name)
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	issuer, verifier := validSigner(), validSigner()
+	ensure.Nil(t, Compatible(&issuer, &verifier))
+	ensure.Nil(t, Compatible(&verifier, &issuer))
+
+	cases := []struct {
+		Name     string
+		Verifier func(*Signer)
+		Err      string
+	}{
+		{
+			Name:     "encoding",
+			Verifier: func(s *Signer) { s.Encoding = Base32Encoding },
+			Err:      "encoding base64url-raw is not accepted",
+		},
+		{
+			Name:     "delimiter",
+			Verifier: func(s *Signer) { s.Delimiter = '~' },
+			Err:      `delimiter '\\x00' does not match '~'`,
+		},
+		{
+			Name:     "version",
+			Verifier: func(s *Signer) { s.MinVersion = versionFlags },
+			Err:      "version 1 is not accepted",
+		},
+		{
+			Name:     "epoch",
+			Verifier: func(s *Signer) { s.Epoch = time.Unix(1e9, 0) },
+			Err:      "epoch does not match",
+		},
+		{
+			Name:     "audience",
+			Verifier: func(s *Signer) { s.Audience = "api" },
+			Err:      `audience "" does not match "api"`,
+		},
+		{
+			Name:     "generation",
+			Verifier: func(s *Signer) { s.MinGeneration = 2 },
+			Err:      "generation 0 is below 2",
+		},
+		{
+			Name:     "secret",
+			Verifier: func(s *Signer) { s.Secret = bytes.Repeat([]byte("b"), 32) },
+			Err:      "wrong secret",
+		},
+		{
+			Name:     "pepper",
+			Verifier: func(s *Signer) { s.Pepper = []byte("pepper") },
+			Err:      "wrong secret",
+		},
+	}
+	for _, c := range cases {
+		verifier := validSigner()
+		c.Verifier(&verifier)
+		ensure.Err(t, Compatible(&issuer, &verifier), regexp.MustCompile(c.Err), c.Name)
+	}
+
+	// Legacy encodings and rotated secrets are accepted.
+	verifier.Encoding = Base32Encoding
+	verifier.LegacyEncodings = []Encoding{issuer.encoding()}
+	verifier.SecretProvider = staticSecrets{
+		bytes.Repeat([]byte("b"), 32),
+		issuer.Secret,
+	}
+	ensure.Nil(t, Compatible(&issuer, &verifier))
+}
@@ -0,0 +1,40 @@
+package hmacsigner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daaku/ensure"
+)
+
+func TestTestVectors(t *testing.T) {
+	vectors := TestVectors()
+	var tokens []string
+	for _, v := range vectors {
+		tokens = append(tokens, v.Token)
+
+		signer := Signer{
+			Secret: v.Secret,
+			TTL:    time.Since(v.Issue) + time.Hour,
+		}
+		payload, err := signer.Parse([]byte(v.Token))
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, payload, v.Payload)
+	}
+	ensure.DeepEqual(t, tokens, []string{
+		"AQAAAAAAAAAAAAECAwQFBgej5pZ_LU57zifBgHDrdXko9vNTIF2wU4o-GKPovR2evw",
+		"AQAAAAAAAAAAAAECAwQFBgccnyOnmh2t0YOuMjv4vUxPALpkI1q-V1a0vKqZRmc-6AYUBiLmM",
+		"ARXN-9-FVzQW__79_Pv6-fgmci_3rcISpwJVluHr4Mrqf_HmuUJHiGedVSzgqu8dggAAEC_f7_",
+		"AQAAyE5nbcEbCAgICAgICAhCuaInqlXLkFG0EMsMRkUTwhwb3uc7Bp00xMaDvNU7RgaG1hY3N" +
+			"pZ25lcmhtYWNzaWduZXJobWFjc2lnbmVyaG1hY3NpZ25lcmhtYWNzaWduZXJobWFjc2lnbm" +
+			"VyaG1hY3NpZ25lcmhtYWNzaWduZXJobWFjc2lnbmVyaG1hY3NpZ25lcg",
+	})
+}
+
+func TestFormatSpec(t *testing.T) {
+	// Changing this means tokens are no longer compatible with other
+	// implementations.
+	ensure.DeepEqual(t, FormatSpec(), "hmacsigner v1 version:1 issue:8:le:unixnano "+
+		"salt:8 sig:32 hmac-sha256(version|issue|salt|payload) "+
+		"base64-rawurl(header|payload)")
+}